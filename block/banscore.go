@@ -0,0 +1,205 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	//この点数に達したノードは一時的に接続を拒否する
+	BAN_THRESHOLD    = 100
+	BAN_DURATION_SEC = 60 * 60
+	//banされていないノードの点数は1分ごとにこれだけ減る
+	SCORE_DECAY_PER_MIN = 1
+
+	//不正な行為の種類
+	MISBEHAVIOR_INVALID_BLOCK       = "invalid_block"
+	MISBEHAVIOR_INVALID_TRANSACTION = "invalid_transaction"
+	MISBEHAVIOR_TIMEOUT             = "timeout"
+	MISBEHAVIOR_PROTOCOL            = "protocol_violation"
+)
+
+//不正な行為ごとの点数
+var MISBEHAVIOR_SCORES = map[string]int{
+	MISBEHAVIOR_INVALID_BLOCK:       100,
+	MISBEHAVIOR_INVALID_TRANSACTION: 10,
+	MISBEHAVIOR_TIMEOUT:             5,
+	MISBEHAVIOR_PROTOCOL:            20,
+}
+
+var (
+	//他のノードから受け取ったBlockが不正だった
+	ErrInvalidBlock = errors.New("invalid block")
+	//他のノードの応答が不正な形式だった
+	ErrProtocolViolation = errors.New("protocol violation")
+)
+
+//ノードの不正な行為の点数とban
+type PeerScore struct {
+	address     string
+	score       int
+	bannedUntil int64
+	//点数を最後に減らした時刻
+	decayedAt int64
+	//最後に記録した行為と理由
+	lastMisbehavior string
+	lastReason      string
+}
+
+func (s *PeerScore) Address() string {
+	return s.address
+}
+
+func (s *PeerScore) MarshalJSON() ([]byte, error) {
+	var bannedUntil *int64
+	if s.bannedUntil > 0 {
+		bannedUntil = &s.bannedUntil
+	}
+	return json.Marshal(struct {
+		Address         string `json:"address"`
+		Score           int    `json:"score"`
+		Banned          bool   `json:"banned"`
+		BannedUntil     *int64 `json:"banned_until,omitempty"`
+		LastMisbehavior string `json:"last_misbehavior"`
+		LastReason      string `json:"last_reason"`
+	}{
+		Address:         s.address,
+		Score:           s.score,
+		Banned:          s.bannedUntil > 0,
+		BannedUntil:     bannedUntil,
+		LastMisbehavior: s.lastMisbehavior,
+		LastReason:      s.lastReason,
+	})
+}
+
+//点数とbanを記録するキー（IPアドレス）
+//portや名乗るアドレスを変えてもbanから逃れられないようにhost:portからportを除く
+func banKey(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+//タイムアウトによるエラーか判定する
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+//他のノードへのrequestのエラーの種類に応じて点数を加えるメソッド（接続できないだけなら加えない）
+func (pm *PeerManager) penalize(peer string, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidBlock):
+		pm.Misbehaving(peer, MISBEHAVIOR_INVALID_BLOCK, err.Error())
+	case errors.Is(err, ErrProtocolViolation):
+		pm.Misbehaving(peer, MISBEHAVIOR_PROTOCOL, err.Error())
+	case isTimeout(err):
+		pm.Misbehaving(peer, MISBEHAVIOR_TIMEOUT, err.Error())
+	}
+}
+
+//ノードの不正な行為をIPアドレスごとに記録し、点数がBAN_THRESHOLDに達したらbanするメソッド（banした場合はtrue）
+func (pm *PeerManager) Misbehaving(address string, misbehavior string, reason string) bool {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	address = banKey(address)
+	pm.decayScores()
+	s, ok := pm.scores[address]
+	if !ok {
+		s = &PeerScore{address: address, decayedAt: time.Now().UnixNano()}
+		pm.scores[address] = s
+	}
+	s.score += MISBEHAVIOR_SCORES[misbehavior]
+	s.lastMisbehavior = misbehavior
+	s.lastReason = reason
+	log.Printf("action=misbehaving, peer=%s, misbehavior=%s, score=%d, reason=%s", address, misbehavior, s.score, reason)
+	if s.bannedUntil > 0 || s.score < BAN_THRESHOLD {
+		return false
+	}
+
+	s.bannedUntil = time.Now().Add(BAN_DURATION_SEC * time.Second).UnixNano()
+	outbound := make([]string, 0, len(pm.outbound))
+	for _, peer := range pm.outbound {
+		if banKey(peer) != address {
+			outbound = append(outbound, peer)
+		} else {
+			delete(pm.versions, peer)
+		}
+	}
+	pm.outbound = outbound
+	log.Printf("action=ban, peer=%s, until=%d", address, s.bannedUntil)
+	return true
+}
+
+//時間の経った点数を減らし、期限の切れたbanを解除するメソッド（banの解除では点数も消す）
+func (pm *PeerManager) decayScores() {
+	now := time.Now().UnixNano()
+	for address, s := range pm.scores {
+		if s.bannedUntil > 0 {
+			if s.bannedUntil <= now {
+				delete(pm.scores, address)
+			}
+			continue
+		}
+		minutes := (now - s.decayedAt) / int64(time.Minute)
+		if minutes <= 0 {
+			continue
+		}
+		s.score -= int(minutes) * SCORE_DECAY_PER_MIN
+		s.decayedAt += minutes * int64(time.Minute)
+		if s.score <= 0 {
+			delete(pm.scores, address)
+		}
+	}
+}
+
+func (pm *PeerManager) isBanned(address string) bool {
+	s, ok := pm.scores[banKey(address)]
+	return ok && s.bannedUntil > time.Now().UnixNano()
+}
+
+//ノードのIPアドレスがbanされているか判定するメソッド
+func (pm *PeerManager) IsBanned(address string) bool {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	return pm.isBanned(address)
+}
+
+//banを解除し点数を消すメソッド（記録がなければfalse）
+func (pm *PeerManager) Unban(address string) bool {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	address = banKey(address)
+	if _, ok := pm.scores[address]; !ok {
+		return false
+	}
+	delete(pm.scores, address)
+	log.Printf("action=unban, peer=%s", address)
+	return true
+}
+
+//点数の記録があるノードを点数の高い順に返すメソッド
+func (pm *PeerManager) Scores() []*PeerScore {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	pm.decayScores()
+	scores := make([]*PeerScore, 0, len(pm.scores))
+	for _, s := range pm.scores {
+		c := *s
+		scores = append(scores, &c)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].score != scores[j].score {
+			return scores[i].score > scores[j].score
+		}
+		return scores[i].address < scores[j].address
+	})
+	return scores
+}
@@ -0,0 +1,77 @@
+package block
+
+import (
+	"testing"
+	"time"
+)
+
+//banされていないノードの点数は時間とともに減り、0になれば記録を消す
+func TestScoreDecay(t *testing.T) {
+	pm := NewPeerManager(PeerConfig{Address: "127.0.0.1:3000"})
+	peer := "127.0.0.1:3001"
+	pm.Misbehaving(peer, MISBEHAVIOR_PROTOCOL, "test")
+	pm.Misbehaving(peer, MISBEHAVIOR_INVALID_TRANSACTION, "test")
+
+	pm.scores[banKey(peer)].decayedAt -= int64(10 * time.Minute)
+	scores := pm.Scores()
+	if len(scores) != 1 || scores[0].score != 30-10*SCORE_DECAY_PER_MIN {
+		t.Fatalf("scores after 10 minutes = %+v", scores)
+	}
+
+	pm.scores[banKey(peer)].decayedAt -= int64(time.Hour)
+	if scores := pm.Scores(); len(scores) != 0 {
+		t.Fatalf("scores after an hour = %+v", scores)
+	}
+}
+
+//点数がBAN_THRESHOLDに達したらbanし、banの間は点数が減らない
+func TestBanUntilExpiry(t *testing.T) {
+	pm := NewPeerManager(PeerConfig{Address: "127.0.0.1:3000"})
+	peer := "127.0.0.1:3001"
+	if !pm.Misbehaving(peer, MISBEHAVIOR_INVALID_BLOCK, "test") || !pm.IsBanned(peer) {
+		t.Fatal("peer is not banned at the threshold")
+	}
+
+	pm.scores[banKey(peer)].decayedAt -= int64(time.Hour)
+	if !pm.IsBanned(peer) || pm.Scores()[0].score != MISBEHAVIOR_SCORES[MISBEHAVIOR_INVALID_BLOCK] {
+		t.Fatal("score of a banned peer decayed")
+	}
+
+	pm.scores[banKey(peer)].bannedUntil = time.Now().UnixNano() - 1
+	if pm.IsBanned(peer) || len(pm.Scores()) != 0 {
+		t.Fatal("ban did not expire")
+	}
+}
+
+//banはIPアドレスごとなので、portや名乗るアドレスを変えても解除されない
+func TestBanByIPAddress(t *testing.T) {
+	pm := NewPeerManager(PeerConfig{Address: "127.0.0.1:3000"})
+	pm.outbound = []string{"10.0.0.1:3001", "10.0.0.1:3002", "10.0.0.2:3001"}
+	if !pm.Misbehaving("10.0.0.1:3001", MISBEHAVIOR_INVALID_BLOCK, "test") {
+		t.Fatal("peer is not banned at the threshold")
+	}
+	for _, address := range []string{"10.0.0.1:3001", "10.0.0.1:4000", "10.0.0.1"} {
+		if !pm.IsBanned(address) {
+			t.Errorf("%s is not banned", address)
+		}
+	}
+	if pm.IsBanned("10.0.0.2:3001") {
+		t.Error("another IP address is banned")
+	}
+	if outbound := pm.Outbound(); len(outbound) != 1 || outbound[0] != "10.0.0.2:3001" {
+		t.Errorf("outbound = %v", outbound)
+	}
+
+	//別のportからの不正な行為も同じ点数に加える
+	pm.Misbehaving("10.0.0.3:3001", MISBEHAVIOR_PROTOCOL, "test")
+	pm.Misbehaving("10.0.0.3:3002", MISBEHAVIOR_PROTOCOL, "test")
+	pm.Misbehaving("10.0.0.3", MISBEHAVIOR_PROTOCOL, "test")
+	for _, s := range pm.Scores() {
+		if s.Address() == "10.0.0.3" && s.score != 3*MISBEHAVIOR_SCORES[MISBEHAVIOR_PROTOCOL] {
+			t.Errorf("score of 10.0.0.3 = %d", s.score)
+		}
+	}
+	if !pm.Unban("10.0.0.1:9999") || pm.IsBanned("10.0.0.1:3001") {
+		t.Error("unban by another port failed")
+	}
+}
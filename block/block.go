@@ -1,64 +1,90 @@
 package block
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
-//Blockの情報
+//Blockの情報（ヘッダーとtransactionの本体）
 type Block struct {
-	timestamp    int64
-	nonce        int
-	previousHash [32]byte
+	header       BlockHeader
 	transactions []*Transaction
+	//chainに追加した後はヘッダーが変わらないのでhashを保持しておく
+	hash       [32]byte
+	hashCached bool
 }
 
 //適切にJSONMarshalするメソッドオーバーライド（json.Marshalの上書き）小文字のフィールドはmarshalできないがjsonでは小文字で扱いたい
 func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Timestamp    int64          `json:"timestamp"`
-		Nonce        int            `json:"nonce"`
-		PreviousHash string         `json:"previous_hash"`
+		Hash         string         `json:"hash"`
+		Header       *BlockHeader   `json:"header"`
 		Transactions []*Transaction `json:"transactions"`
 	}{
-		Timestamp:    b.timestamp,
-		Nonce:        b.nonce,
-		PreviousHash: fmt.Sprintf("%x", b.previousHash),
+		Hash:         fmt.Sprintf("%x", b.Hash()),
+		Header:       &b.header,
 		Transactions: b.transactions,
 	})
 }
 
 //Unmarshal
 func (b *Block) UnmarshalJSON(data []byte) error {
-	var preHash string
 	v := &struct {
-		Timestamp    *int64          `json:"timestamp"`
-		Nonce        *int            `json:"nonce"`
-		PreviousHash *string         `json:"previous_hash"`
+		Header       *BlockHeader    `json:"header"`
 		Transactions *[]*Transaction `json:"transactions"`
 	}{
-		Timestamp:    &b.timestamp,
-		Nonce:        &b.nonce,
-		PreviousHash: &preHash,
+		Header:       &b.header,
 		Transactions: &b.transactions,
 	}
 
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
-	ph, _ := hex.DecodeString(*v.PreviousHash)
-	copy(b.previousHash[:], ph[:32])
+	for _, t := range b.transactions {
+		if t == nil {
+			return errors.New("null transaction")
+		}
+	}
+	b.cacheHash()
 	return nil
 }
 
+func (b *Block) Header() *BlockHeader {
+	return &b.header
+}
+
+//Blockのサイズ（headerと全transactionのJSONのbyte数）
+func (b *Block) Size() int {
+	size := HEADER_SIZE
+	for _, t := range b.transactions {
+		size += t.Size()
+	}
+	return size
+}
+
+func (b *Block) Version() uint32 {
+	return b.header.version
+}
+
+func (b *Block) Height() uint64 {
+	return b.header.height
+}
+
 func (b *Block) PreviousHash() [32]byte {
-	return b.previousHash
+	return b.header.previousHash
+}
+
+func (b *Block) Timestamp() int64 {
+	return b.header.timestamp
+}
+
+func (b *Block) Target() [32]byte {
+	return b.header.target
 }
 
 func (b *Block) Nonce() int {
-	return b.nonce
+	return b.header.nonce
 }
 
 func (b *Block) Transactions() []*Transaction {
@@ -67,16 +93,32 @@ func (b *Block) Transactions() []*Transaction {
 
 //Blockのプリント用メソッド
 func (b *Block) Print() {
-	fmt.Printf("timestamp    : %d\n", b.timestamp)
-	fmt.Printf("nonce        : %d\n", b.nonce)
-	fmt.Printf("previousHash : %x\n", b.previousHash)
+	fmt.Printf("height       : %d\n", b.header.height)
+	fmt.Printf("timestamp    : %d\n", b.header.timestamp)
+	fmt.Printf("nonce        : %d\n", b.header.nonce)
+	fmt.Printf("previousHash : %x\n", b.header.previousHash)
+	fmt.Printf("merkleRoot   : %x\n", b.header.merkleRoot)
+	fmt.Printf("target       : %x\n", b.header.target)
 	for _, t := range b.transactions {
 		t.Print()
 	}
 }
 
-//BlockのHash化
+//transactionのhashから計算したMerkle root
+func (b *Block) ComputeMerkleRoot() [32]byte {
+	return MerkleRoot(transactionHashes(b.transactions))
+}
+
+//BlockのHash化（ヘッダーのみが対象）
 func (b *Block) Hash() [32]byte {
-	m, _ := json.Marshal(b)
-	return sha256.Sum256(m)
+	if b.hashCached {
+		return b.hash
+	}
+	return b.header.Hash()
+}
+
+//hashを計算して保持するメソッド（ヘッダーが確定した後に呼ぶ）
+func (b *Block) cacheHash() {
+	b.hash = b.header.Hash()
+	b.hashCached = true
 }
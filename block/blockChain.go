@@ -3,40 +3,51 @@ package block
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gobc/def"
 	"gobc/utils"
+	"io"
 	"log"
 	"net/http"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/color"
 )
 
 const (
-	MINING_DIFFICULTY  = 3
-	MINING_SENDER      = "NETWORK"
-	MINER_ADDRESS      = "Miner"
-	MINING_REWARD      = 1.00
-	MINIG_INTERVAL_SEC = 10
+	MINING_DIFFICULTY = 3
+	MINING_SENDER     = "NETWORK"
+	MINER_ADDRESS     = "Miner"
+	MINING_REWARD     = 1 * utils.COIN
 
 	PORT_RANGE_START       = 3000
 	PORT_RANGE_END         = 3005
 	IP_RANGE_START         = 0
 	IP_RANGE_END           = 1
 	NEIGHBOR_SYNC_TIME_SEC = 20
+	//取りこぼしたBlockを取得するために他のノードと同期する間隔
+	RESOLVE_CONFLICTS_INTERVAL_SEC = 30
+	//マイニングが失敗・中断した後に次を始めるまでの待ち時間（保存のエラーなどで空回りしない）
+	MINING_RETRY_INTERVAL_MS = 500
 )
 
 //新規Block作成
-func NewBlock(nonce int, previousHash [32]byte, transactions []*Transaction) *Block {
+func NewBlock(nonce int, height uint64, previousHash [32]byte, target [32]byte, transactions []*Transaction) *Block {
 	b := new(Block)
-	b.timestamp = time.Now().UnixNano()
-	b.nonce = nonce
-	b.previousHash = previousHash
+	b.header.version = BLOCK_VERSION
+	b.header.height = height
+	b.header.timestamp = time.Now().UnixNano()
+	b.header.nonce = nonce
+	b.header.previousHash = previousHash
+	b.header.target = target
 	b.transactions = transactions
+	b.header.merkleRoot = b.ComputeMerkleRoot()
 	return b
 }
 
@@ -47,30 +58,87 @@ type BlockChain struct {
 	minerAddress    string
 	port            uint16
 	mutexMinig      sync.Mutex
-
+	isMining        int32
+	miner           *Miner
+	storage         Storage
+	params          *Params
+	//ネットワークの定義と、そこから作ったGenesis Blockのhash
+	genesis     *Genesis
+	genesisHash [32]byte
+	networkID   string
+	//他のノードから見た自身のアドレス（host:port）
+	address string
+	//chainとtransactionPoolの更新用
+	mutexChain sync.Mutex
+	//Poolから除外されたtransaction（新しいものが末尾）
+	droppedTransactions []*DroppedTransaction
+	//chainの先頭が変わると閉じられる（マイニングの中断用）
+	tipChanged chan struct{}
+	//Blockのhash -> 高さ
+	hashIndex map[[32]byte]uint64
+	//transactionのID -> 含まれるBlockの位置
+	txIndex map[[32]byte]txLocation
+	//address -> 関係するtransactionの位置（古いものが先頭）
+	addressIndex map[string][]txLocation
+	//chainを適用した残高・nonce（Blockの追加・ロールバックごとに更新する）
+	state *chainState
+
+	peers        *PeerManager
 	neighbors    []string
 	mutexNeibors sync.Mutex
+	//他のノードのchainと同期中か、とその進捗
+	isSyncing  int32
+	syncStatus SyncStatus
+	mutexSync  sync.Mutex
 }
 
 //chainのMarshal
 func (bc *BlockChain) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Blocks []*Block `json:"chain"`
+		NetworkID string   `json:"network_id"`
+		Blocks    []*Block `json:"chain"`
 	}{
-		Blocks: bc.chain,
+		NetworkID: bc.networkID,
+		Blocks:    bc.Chain(),
 	})
 }
 
+//chainのコピーを返すメソッド（Blockは変更されないので、lockの外でそのまま読める）
 func (bc *BlockChain) Chain() []*Block {
-	return bc.chain
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	return append([]*Block{}, bc.chain...)
+}
+
+func (bc *BlockChain) NetworkID() string {
+	return bc.networkID
+}
+
+func (bc *BlockChain) Genesis() *Genesis {
+	return bc.genesis
+}
+
+func (bc *BlockChain) GenesisHash() [32]byte {
+	return bc.genesisHash
+}
+
+//他のノードへのrequest
+//（異なるネットワークのノードが拒否できるようネットワークIDを、受け取ったノードが問い合わせられるよう自身のアドレスを付ける）
+func (bc *BlockChain) newPeerRequest(method string, endpoint string, body io.Reader) *http.Request {
+	req, _ := http.NewRequest(method, endpoint, body)
+	req.Header.Set(def.NETWORK_ID_HEADER, bc.networkID)
+	req.Header.Set(def.NODE_ADDRESS_HEADER, bc.address)
+	return req
 }
 
 //chainのUnmarshal
 func (bc *BlockChain) UnmarshalJSON(data []byte) error {
 	v := &struct {
-		Blocks *[]*Block `json:"chain"`
+		NetworkID *string   `json:"network_id"`
+		Blocks    *[]*Block `json:"chain"`
 	}{
-		Blocks: &bc.chain,
+		NetworkID: &bc.networkID,
+		Blocks:    &bc.chain,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
@@ -79,29 +147,105 @@ func (bc *BlockChain) UnmarshalJSON(data []byte) error {
 }
 
 //BlockChainの作成（初期化）
-func NewBlockChain(minerAddress string, port uint16) *BlockChain {
-	//Genesis Block
-	b := &Block{}
+//storageにchainがあればそこから復元し、なければgenesisからGenesis Blockを作成する
+func NewBlockChain(minerAddress string, port uint16, storage Storage, genesis *Genesis) (*BlockChain, error) {
+	params := genesis.Params
 	bc := new(BlockChain)
 	bc.minerAddress = minerAddress
-	bc.AddBlock(0, b.Hash())
 	bc.port = port
-	return bc
+	bc.address = fmt.Sprintf("%s:%d", utils.GetHost(), port)
+	bc.SetPeerManager(NewPeerManager(PeerConfig{Address: bc.address, Scan: true}))
+	bc.storage = storage
+	bc.params = params
+	//発行量の上限にGenesis Blockの配布を含める
+	params.allocated, _ = genesis.AllocatedSupply()
+	bc.genesis = genesis
+	bc.genesisHash = genesis.Hash()
+	bc.networkID = genesis.NetworkID
+	bc.miner = NewMiner(runtime.NumCPU())
+	bc.tipChanged = make(chan struct{})
+	bc.hashIndex = make(map[[32]byte]uint64)
+	bc.txIndex = make(map[[32]byte]txLocation)
+	bc.addressIndex = make(map[string][]txLocation)
+	bc.state = newChainState(params.IsUTXO())
+
+	chain, err := storage.LoadChain()
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		if !bc.AddBlock(genesis.Block()) {
+			return nil, errors.New("failed to store genesis block")
+		}
+		return bc, nil
+	}
+
+	if chain[0].Hash() != bc.genesisHash {
+		return nil, fmt.Errorf("stored chain belongs to another network (genesis %x, expected %x for %s)", chain[0].Hash(), bc.genesisHash, bc.networkID)
+	}
+	if !bc.VaildChain(chain) {
+		return nil, errors.New("stored chain is invalid")
+	}
+	bc.chain = chain
+	bc.rebuildIndex()
+	bc.state = replayState(chain, params.IsUTXO())
+	pool, err := storage.LoadPool()
+	if err != nil {
+		return nil, err
+	}
+	//Poolの署名は受け入れる時にしか検証しないので、保存されていたものはここで検証する
+	bc.transactionPool = make([]*Transaction, 0, len(pool))
+	for _, t := range pool {
+		if !t.HasValidSignatures() {
+			bc.dropTransaction(t, fmt.Errorf("transaction %s: invalid signature", t.ID()))
+			continue
+		}
+		bc.transactionPool = append(bc.transactionPool, t)
+	}
+	bc.prunePool()
+	log.Printf("action=load_chain, blocks=%d, pool=%d", len(bc.chain), len(bc.transactionPool))
+	return bc, nil
+}
+
+//ノードの探し方を設定するメソッド（Runの前に呼ぶ）
+func (bc *BlockChain) SetPeerManager(pm *PeerManager) {
+	bc.peers = pm
+	bc.address = pm.Address()
+	pm.newRequest = bc.newPeerRequest
+	pm.handshake = bc.handshake
+}
+
+func (bc *BlockChain) Peers() *PeerManager {
+	return bc.peers
 }
 
 //他のノードを取得するメソッド
 func (bc *BlockChain) SetNeighbors() {
-	bc.neighbors = utils.FindNeighbors(utils.GetHost(), bc.port, IP_RANGE_START, IP_RANGE_END, PORT_RANGE_START, PORT_RANGE_END)
+	neighbors := bc.peers.Refresh()
+	bc.mutexNeibors.Lock()
+	bc.neighbors = neighbors
+	bc.mutexNeibors.Unlock()
 	color.Cyan("NODES")
-	for _, node := range bc.neighbors {
+	for _, node := range neighbors {
 		color.HiMagenta("> " + node)
 	}
 }
 
 func (bc *BlockChain) SyncNeighbors() {
+	bc.SetNeighbors()
+}
+
+//接続中の他のノード（banしたノードは除く）
+func (bc *BlockChain) Neighbors() []string {
 	bc.mutexNeibors.Lock()
 	defer bc.mutexNeibors.Unlock()
-	bc.SetNeighbors()
+	neighbors := make([]string, 0, len(bc.neighbors))
+	for _, node := range bc.neighbors {
+		if !bc.peers.IsBanned(node) {
+			neighbors = append(neighbors, node)
+		}
+	}
+	return neighbors
 }
 
 func (bc *BlockChain) StartSyncNeighbors() {
@@ -109,10 +253,16 @@ func (bc *BlockChain) StartSyncNeighbors() {
 	_ = time.AfterFunc(time.Second*NEIGHBOR_SYNC_TIME_SEC, bc.StartSyncNeighbors)
 }
 
+//定期的に他のノードと同期するメソッド（push型の伝播で届かなかったBlockも取得する）
+func (bc *BlockChain) StartResolveConflicts() {
+	bc.ResolveConflicts()
+	_ = time.AfterFunc(time.Second*RESOLVE_CONFLICTS_INTERVAL_SEC, bc.StartResolveConflicts)
+}
+
 //ノード立ち上げ時のメソッド
 func (bc *BlockChain) Run() {
-	bc.ResolveConflicts()
 	bc.StartSyncNeighbors()
+	bc.StartResolveConflicts()
 	bc.StartMining()
 }
 
@@ -126,77 +276,110 @@ func (bc *BlockChain) Mining() bool {
 	// 	return false
 	// }
 
-	//ネットワークからマイナーへのTransaction追加
-	bc.AddTransaction(MINING_SENDER, bc.minerAddress, MINING_REWARD, nil, nil)
-	//PoW
-	nonce := bc.ProofOfWork()
-	preHash := bc.LastBlock().Hash()
-	bc.AddBlock(nonce, preHash)
-	log.Println("action=mining, status=success")
-
-	for _, node := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/consensus", node)
-		client := &http.Client{}
-		req, _ := http.NewRequest("PUT", endpoint, nil)
-		response, _ := client.Do(req)
-		log.Println(response)
+	//Poolから有効なtransactionを選びマイニング報酬を追加
+	b, abort := bc.assembleBlock()
+	//PoW（他のノードのBlockでchainの先頭が変わったら中断）
+	nonce, ok := bc.miner.Mine(b, abort)
+	if !ok {
+		return false
 	}
+	b.header.nonce = nonce
+	if !bc.AddBlock(b) {
+		log.Println("action=mining, status=fail")
+		return false
+	}
+	log.Printf("action=mining, status=success, height=%d, target=%x, hashrate=%.0f", b.Height(), b.Target(), bc.miner.Hashrate())
 
+	bc.broadcastBlock(b, "")
 	return true
 }
 
-//intervalごとにminingを開始
+//継続的にminingを行う（Blockの生成間隔は難易度調整で保つ）
 func (bc *BlockChain) StartMining() {
-	bc.Mining()
-	_ = time.AfterFunc(time.Second*MINIG_INTERVAL_SEC, bc.StartMining)
+	if !atomic.CompareAndSwapInt32(&bc.isMining, 0, 1) {
+		return
+	}
+	go func() {
+		for {
+			if !bc.Mining() {
+				time.Sleep(MINING_RETRY_INTERVAL_MS * time.Millisecond)
+			}
+		}
+	}()
 }
 
 //アドレスをもとにtransactionによる差分を計算
-func (bc *BlockChain) CalculateTotalAmount(address string) float32 {
-	var total float32 = 0.00
-
-	//全てのtransaction参照
-	for _, b := range bc.chain {
-		for _, t := range b.transactions {
-			value := t.value
-			if address == t.recipientAddress {
-				total += value
-			}
-			if address == t.senderAddress {
-				total -= value
-			}
-		}
-	}
-	return total
+func (bc *BlockChain) CalculateTotalAmount(address string) (utils.Amount, error) {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	return bc.state.balance(address), nil
 }
 
 type AmountResponse struct {
-	Amount float32 `json:"amount"`
+	Amount utils.Amount `json:"amount"`
+	//まだ使えないマイニング報酬と、使える残高
+	Immature  utils.Amount `json:"immature"`
+	Spendable utils.Amount `json:"spendable"`
 }
 
 func (ar *AmountResponse) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Amount float32 `json:"amount"`
+		Amount    utils.Amount `json:"amount"`
+		Immature  utils.Amount `json:"immature"`
+		Spendable utils.Amount `json:"spendable"`
 	}{
-		Amount: ar.Amount,
+		Amount:    ar.Amount,
+		Immature:  ar.Immature,
+		Spendable: ar.Spendable,
 	})
 }
 
 //BlockをChainに追加するメソッド
-func (bc *BlockChain) AddBlock(nonce int, previousHash [32]byte) *Block {
-	b := NewBlock(nonce, previousHash, bc.transactionPool)
-	bc.chain = append(bc.chain, b)
-	bc.transactionPool = []*Transaction{} //Poolを初期化
+//Blockに入ったtransactionはPoolから削除し、残りは無効になったものを除外する
+func (bc *BlockChain) AddBlock(b *Block) bool {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	//PoW中に他のノードのchainに置き換わっていた場合は追加しない
+	if len(bc.chain) > 0 && bc.LastBlock().Hash() != b.PreviousHash() {
+		log.Println("Error: chain tip changed while mining")
+		return false
+	}
+	return bc.connectBlock(b)
+}
 
-	//他のノードのPoolも初期化
-	for _, node := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/transactions", node)
-		client := &http.Client{}
-		req, _ := http.NewRequest("DELETE", endpoint, nil)
-		res, _ := client.Do(req)
-		log.Println(res)
+//検証済みのBlockをchainの末尾に繋げるメソッド
+func (bc *BlockChain) connectBlock(b *Block) bool {
+	//メモリに追加する前に永続化
+	if err := bc.storage.AppendBlock(b); err != nil {
+		log.Printf("Error: store block: %v", err)
+		return false
 	}
-	return b
+	bc.chain = append(bc.chain, b)
+	bc.indexBlock(b)
+	bc.state.transferBlock(b)
+	bc.notifyTipChanged()
+	bc.removeFromPool(b.transactions)
+	bc.prunePool()
+	return true
+}
+
+//マイナーを差し替えるメソッド（worker数の変更用）
+func (bc *BlockChain) SetMiner(m *Miner) {
+	bc.mutexMinig.Lock()
+	defer bc.mutexMinig.Unlock()
+	bc.miner = m
+}
+
+func (bc *BlockChain) Miner() *Miner {
+	return bc.miner
+}
+
+//chainの先頭が変わったことをマイナーに通知するメソッド
+func (bc *BlockChain) notifyTipChanged() {
+	close(bc.tipChanged)
+	bc.tipChanged = make(chan struct{})
 }
 
 //最後のBlockを返すメソッド
@@ -206,12 +389,24 @@ func (bc *BlockChain) LastBlock() *Block {
 
 //transactionPoolを返すメソッド
 func (bc *BlockChain) TransactionPool() []*Transaction {
-	return bc.transactionPool
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	return append([]*Transaction{}, bc.transactionPool...)
 }
 
 //transactionPoolを空にするメソッド
 func (bc *BlockChain) ClearTransactionPool() {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
 	bc.transactionPool = bc.transactionPool[:0]
+	bc.savePool()
+}
+
+//transactionPoolをストレージに保存するメソッド
+func (bc *BlockChain) savePool() {
+	if err := bc.storage.SavePool(bc.transactionPool); err != nil {
+		log.Printf("Error: store pool: %v", err)
+	}
 }
 
 //BlockChainのプリント用メソッド
@@ -229,137 +424,125 @@ func (bc *BlockChain) Print() {
 
 //transactionのSignを認証するメソッド
 func (bc *BlockChain) VerifyTransactionSign(senderPubKey *ecdsa.PublicKey, s *utils.Signature, t *Transaction) bool {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256([]byte(m))
+	if senderPubKey == nil || s == nil {
+		return false
+	}
+	h := t.Hash()
 	return ecdsa.Verify(senderPubKey, h[:], s.R, s.S)
 }
 
+//senderが次に使うべきnonce（chain上とPool内のtransaction数）
+func (bc *BlockChain) NextNonce(sender string) uint64 {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	return bc.pendingState().nonce(sender)
+}
+
+//同じIDのtransactionがchainかPoolに存在するか判定するメソッド
+func (bc *BlockChain) HasTransaction(id [32]byte) bool {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	return bc.pendingState().hasTransaction(id)
+}
+
 //Transactionを追加し他のノードとシンクさせるメソッド
-func (bc *BlockChain) CreateTransaction(sender string, recipient string, value float32, senderPubKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	isTransacted := bc.AddTransaction(sender, recipient, value, senderPubKey, s)
+func (bc *BlockChain) CreateTransaction(sender string, recipient string, value utils.Amount, fee utils.Amount, nonce uint64, senderPubKey *ecdsa.PublicKey, s *utils.Signature) bool {
+	isTransacted := bc.AddTransaction(sender, recipient, value, fee, nonce, senderPubKey, s)
 
 	//他のノードと同期
 	if isTransacted {
-		for _, node := range bc.neighbors {
-			pubKeyStr := fmt.Sprintf("%064x%064x", senderPubKey.X.Bytes(), senderPubKey.Y.Bytes())
-			signStr := s.String()
-			tr := &TransactionRequest{
-				SenderPublicKey:  &pubKeyStr,
-				SenderAddress:    &sender,
-				RecipientAddress: &recipient,
-				Value:            &value,
-				Signature:        &signStr,
-			}
-			m, _ := json.Marshal(tr)
-			buff := bytes.NewBuffer(m)
-			endpoint := fmt.Sprintf("http://%s/transactions", node)
-			client := &http.Client{}
-			req, _ := http.NewRequest("PUT", endpoint, buff)
-			res, _ := client.Do(req)
-			log.Println(res)
+		pubKeyStr := utils.PublicKeyToString(senderPubKey)
+		signStr := s.String()
+		tr := &TransactionRequest{
+			SenderPublicKey:  &pubKeyStr,
+			SenderAddress:    &sender,
+			RecipientAddress: &recipient,
+			Value:            &value,
+			Fee:              &fee,
+			Nonce:            &nonce,
+			Signature:        &signStr,
 		}
+		m, _ := json.Marshal(tr)
+		bc.broadcastTransaction(m)
 	}
 
 	return isTransacted
 }
 
+//transactionのrequestを他のノードに送るメソッド
+func (bc *BlockChain) broadcastTransaction(m []byte) {
+	for _, node := range bc.Neighbors() {
+		buff := bytes.NewBuffer(m)
+		endpoint := fmt.Sprintf("http://%s/transactions", node)
+		res, err := peerClient().Do(bc.newPeerRequest("PUT", endpoint, buff))
+		if err != nil {
+			log.Printf("Error: send transaction to %s: %v", node, err)
+			bc.peers.penalize(node, err)
+			continue
+		}
+		res.Body.Close()
+		log.Printf("action=broadcast_transaction, node=%s, status=%d", node, res.StatusCode)
+	}
+}
+
 //TransactionをPoolに追加するメソッド
-func (bc *BlockChain) AddTransaction(sender string, recipient string, value float32, senderPubKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	t := NewTransaction(sender, recipient, value)
+func (bc *BlockChain) AddTransaction(sender string, recipient string, value utils.Amount, fee utils.Amount, nonce uint64, senderPubKey *ecdsa.PublicKey, s *utils.Signature) bool {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	t := NewTransaction(sender, recipient, value, fee, nonce, senderPubKey, s)
 
-	//マイニング報酬の場合
+	//マイニング報酬はBlock作成時に追加するのでPoolには入れない
 	if sender == MINING_SENDER {
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
+		log.Println("Error: Mining reward cannot be added to pool")
+		return false
 	}
 
-	if bc.VerifyTransactionSign(senderPubKey, s, t) {
-
-		if bc.CalculateTotalAmount(sender) < value {
-			log.Println("Error: Not enough balance in a wallet")
-			return false
-		}
+	//senderAddressが署名した鍵のアドレスでなければ拒否
+	if !t.IsSenderBound() {
+		log.Println("Error: Sender address does not match public key")
+		return false
+	}
 
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
-	} else {
+	if !bc.VerifyTransactionSign(senderPubKey, s, t) {
 		log.Println("Error: Verify TransactionSign")
+		return false
 	}
-	return false
+
+	return bc.admitTransaction(t)
 }
 
 //PoolのTransactionsをコピーするメソッド
 func (bc *BlockChain) CopyTransactionsFromPool() []*Transaction {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
 	copy := make([]*Transaction, 0)
 	for _, t := range bc.transactionPool {
-		copy = append(copy, NewTransaction(t.senderAddress, t.recipientAddress, t.value))
+		c := *t
+		copy = append(copy, &c)
 	}
 	return copy
 }
 
-//nonceが正しいかどうか判定するメソッド
-func (bc *BlockChain) IsValidProof(nonce int, preHash [32]byte, transactions []*Transaction, difficulty int) bool {
-	zeros := strings.Repeat("0", difficulty)
-	guessBlock := Block{0, nonce, preHash, transactions}
-	guessBlockHash := fmt.Sprintf("%x", guessBlock.Hash()) //byte -> Base16に変換
-	return guessBlockHash[:difficulty] == zeros            //最初の{difficulty}文字判定
-}
-
-//正しいnonceを求めるメソッド
-func (bc *BlockChain) ProofOfWork() int {
-	transactions := bc.CopyTransactionsFromPool()
-	preHash := bc.LastBlock().Hash()
-	nonce := 0
-	//正しいnonceになるまでループ
-	for !bc.IsValidProof(nonce, preHash, transactions, MINING_DIFFICULTY) {
-		nonce += 1
-	}
+//正しいnonceを求めるメソッド（中断しない）
+func (bc *BlockChain) ProofOfWork(b *Block) int {
+	nonce, _ := bc.miner.Mine(b, nil)
 	return nonce
 }
 
 //正しいchainかどうか確認するメソッド
 func (bc *BlockChain) VaildChain(chain []*Block) bool {
-	previousBlock := chain[0]
-	currentIndex := 1
-	for currentIndex < len(chain) {
-		b := chain[currentIndex]
-		if b.previousHash != previousBlock.Hash() {
-			return false
-		}
-
-		if !bc.IsValidProof(b.Nonce(), b.PreviousHash(), b.Transactions(), MINING_DIFFICULTY) {
-			return false
-		}
-
-		previousBlock = b
-		currentIndex += 1
+	if err := bc.ValidateChain(chain); err != nil {
+		log.Printf("Error: invalid chain: %v", err)
+		return false
 	}
 	return true
 }
 
-//長いchainに置き換えるメソッド
+//他のノードと同期し、累積仕事量が最も大きいchainに置き換えるメソッド
 func (bc *BlockChain) ResolveConflicts() bool {
-	var longestChain []*Block = nil
-	maxLengh := len(bc.chain)
-
-	for _, node := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/chain", node)
-		response, _ := http.Get(endpoint)
-		if response.StatusCode == 200 {
-			var bc BlockChain
-			dec := json.NewDecoder(response.Body)
-			_ = dec.Decode(&bc)
-
-			chain := bc.Chain()
-
-			if len(chain) > maxLengh && bc.VaildChain(chain) {
-				maxLengh = len(chain)
-				longestChain = chain
-			}
-		}
-	}
-	if longestChain != nil {
-		bc.chain = longestChain
+	if bc.syncWithPeers(bc.Neighbors()) {
 		log.Println("Resolve conflicts replaced")
 		return true
 	}
@@ -0,0 +1,52 @@
+package block
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+//Blockを繋げている間もchainを読み出せ、返したコピーは後から変わらない（go test -raceで確認する）
+func TestChainReadWhileConnecting(t *testing.T) {
+	bc, _ := newTestBlockChain(t, LEDGER_ACCOUNT)
+	chain := bc.Chain()
+	started := make(chan struct{})
+	var start sync.Once
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer start.Do(func() { close(started) })
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			//1回読み出してから並行してBlockを繋げ始める
+			if i == 1 {
+				start.Do(func() { close(started) })
+			}
+			if _, err := json.Marshal(bc); err != nil {
+				t.Error(err)
+				return
+			}
+			bc.Chain()
+		}
+	}()
+	<-started
+	for height := uint64(1); height <= 5; height++ {
+		bc.mutexChain.Lock()
+		b := nextTestBlock(bc, []*Transaction{bc.newReward(bc.params.RewardForHeight(height), height)})
+		bc.mutexChain.Unlock()
+		if status, err := bc.ReceiveBlock(b, ""); err != nil || status != BLOCK_ACCEPTED {
+			t.Fatalf("block %d: status %q, err %v", height, status, err)
+		}
+	}
+	close(stop)
+	<-done
+
+	if len(chain) != 1 || len(bc.Chain()) != 6 {
+		t.Fatalf("copied chain has %d blocks, chain has %d", len(chain), len(bc.Chain()))
+	}
+}
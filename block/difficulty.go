@@ -0,0 +1,68 @@
+package block
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+)
+
+//1回の調整で変化させる難易度の上限（倍率）
+const MAX_RETARGET_FACTOR = 4
+
+//先頭bits個が0でそれ以外が1のtarget
+func TargetFromBits(bits uint) [32]byte {
+	t := new(big.Int).Lsh(big.NewInt(1), 256-bits)
+	t.Sub(t, big.NewInt(1))
+	return bigToTarget(t)
+}
+
+func bigToTarget(n *big.Int) [32]byte {
+	var target [32]byte
+	n.FillBytes(target[:])
+	return target
+}
+
+func targetToBig(target [32]byte) *big.Int {
+	return new(big.Int).SetBytes(target[:])
+}
+
+//hashがtarget以下か判定（どちらもbig endianの256bit整数として比較）
+func meetsTarget(hash [32]byte, target [32]byte) bool {
+	return bytes.Compare(hash[:], target[:]) <= 0
+}
+
+//chainの次に来るBlockのtarget
+//RetargetInterval Blockごとに直近の生成時間が目標に近づくよう調整する
+func (p *Params) NextTarget(chain []*Block) [32]byte {
+	height := len(chain)
+	limit := TargetFromBits(p.InitialDifficultyBits)
+	if height <= 1 {
+		return limit
+	}
+	last := chain[height-1]
+	n := p.RetargetInterval
+	if n < 2 || height%n != 0 {
+		return last.Target()
+	}
+
+	first := chain[height-n]
+	actual := last.Timestamp() - first.Timestamp()
+	expected := int64(n-1) * p.TargetBlockIntervalSec * int64(time.Second)
+	if actual < expected/MAX_RETARGET_FACTOR {
+		actual = expected / MAX_RETARGET_FACTOR
+	}
+	if actual > expected*MAX_RETARGET_FACTOR {
+		actual = expected * MAX_RETARGET_FACTOR
+	}
+
+	next := targetToBig(last.Target())
+	next.Mul(next, big.NewInt(actual))
+	next.Div(next, big.NewInt(expected))
+	if next.Cmp(targetToBig(limit)) > 0 {
+		next = targetToBig(limit)
+	}
+	if next.Sign() == 0 {
+		next.SetInt64(1)
+	}
+	return bigToTarget(next)
+}
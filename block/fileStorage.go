@@ -0,0 +1,238 @@
+package block
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	CHAIN_FILE = "chain.log"
+	POOL_FILE  = "pool.json"
+
+	recordHeaderSize = 8 //length(4byte) + crc32(4byte)
+)
+
+//ディレクトリにchainを追記型ファイルで保存するストレージ
+//1レコード = [length][crc32][BlockのJSON]
+type FileStorage struct {
+	dir   string
+	file  *os.File
+	mutex sync.Mutex
+}
+
+//dirを作成しchainファイルを開く
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	fs := &FileStorage{dir: dir}
+	if err := fs.openChainFile(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileStorage) chainPath() string {
+	return filepath.Join(fs.dir, CHAIN_FILE)
+}
+
+func (fs *FileStorage) poolPath() string {
+	return filepath.Join(fs.dir, POOL_FILE)
+}
+
+func (fs *FileStorage) openChainFile() error {
+	f, err := os.OpenFile(fs.chainPath(), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	fs.file = f
+	return nil
+}
+
+//全レコードを読み込む
+//書き込み途中でクラッシュした末尾の壊れたレコードは切り捨てる
+func (fs *FileStorage) LoadChain() ([]*Block, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, err := fs.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	info, err := fs.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(fs.file)
+	chain := make([]*Block, 0)
+	var offset int64 = 0
+	for {
+		payload, err := readRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Warning: truncate broken record at offset %d: %v", offset, err)
+			if err := fs.file.Truncate(offset); err != nil {
+				return nil, err
+			}
+			if err := fs.file.Sync(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		var b Block
+		if err := json.Unmarshal(payload, &b); err != nil {
+			return nil, fmt.Errorf("block %d: %v", len(chain), err)
+		}
+		chain = append(chain, &b)
+		offset += int64(recordHeaderSize + len(payload))
+	}
+	if _, err := fs.file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+//Blockを1レコードとして追記しfsyncする
+func (fs *FileStorage) AppendBlock(b *Block) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	m, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if _, err := fs.file.Write(encodeRecord(m)); err != nil {
+		return err
+	}
+	return fs.file.Sync()
+}
+
+//一時ファイルに全Blockを書き込んでからrenameで置き換える
+func (fs *FileStorage) ReplaceChain(chain []*Block) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	buf := make([]byte, 0)
+	for _, b := range chain {
+		m, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, encodeRecord(m)...)
+	}
+	if err := writeFileAtomic(fs.chainPath(), buf); err != nil {
+		return err
+	}
+	fs.file.Close()
+	return fs.openChainFile()
+}
+
+func (fs *FileStorage) LoadPool() ([]*Transaction, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	pool := make([]*Transaction, 0)
+	m, err := os.ReadFile(fs.poolPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return pool, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(m, &pool); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+func (fs *FileStorage) SavePool(pool []*Transaction) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	m, err := json.Marshal(pool)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fs.poolPath(), m)
+}
+
+func (fs *FileStorage) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.file.Close()
+}
+
+func encodeRecord(payload []byte) []byte {
+	rec := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	copy(rec[recordHeaderSize:], payload)
+	return rec
+}
+
+//remainingは読み込み位置からファイル末尾までのbyte数（壊れた長さで巨大な領域を確保しないため）
+func readRecord(r io.Reader, remaining int64) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("short header (%d bytes)", n)
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > remaining-recordHeaderSize {
+		return nil, fmt.Errorf("record length %d exceeds the remaining %d bytes", length, remaining-recordHeaderSize)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.New("short payload")
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
+
+//一時ファイルに書き込みfsyncしてからrenameする（途中でクラッシュしても元のファイルは壊れない）
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	//renameをディレクトリに反映させる
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
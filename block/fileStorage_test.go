@@ -0,0 +1,44 @@
+package block
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+//ファイルの残りより長いと書かれた末尾のレコードは、その長さの領域を確保せず切り捨てる
+func TestLoadChainTruncatesOversizedRecord(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.AppendBlock(DefaultGenesis().Block()); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := fs.file.Stat()
+	valid := info.Size()
+	fs.Close()
+
+	broken := make([]byte, recordHeaderSize+16)
+	binary.BigEndian.PutUint32(broken[0:4], 0xFFFFFFF0)
+	f, err := os.OpenFile(fs.chainPath(), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(broken)
+	f.Close()
+
+	fs, err = NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	chain, err := fs.LoadChain()
+	if err != nil || len(chain) != 1 {
+		t.Fatalf("loaded %d blocks, err %v", len(chain), err)
+	}
+	if info, _ := fs.file.Stat(); info.Size() != valid {
+		t.Fatalf("file size %d, want %d", info.Size(), valid)
+	}
+}
@@ -0,0 +1,140 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gobc/utils"
+	"os"
+)
+
+const (
+	DEFAULT_NETWORK_ID = "gobc-dev"
+	//2022-01-01T00:00:00Z（ナノ秒）
+	GENESIS_TIMESTAMP = 1640995200000000000
+)
+
+//Genesis Blockで配布する初期残高
+type Allocation struct {
+	Address string       `json:"address"`
+	Value   utils.Amount `json:"value"`
+}
+
+//ネットワークの定義（同じ内容から作ったGenesis Blockは同じhashになる）
+type Genesis struct {
+	NetworkID   string        `json:"network_id"`
+	Timestamp   int64         `json:"timestamp"`
+	Allocations []*Allocation `json:"allocations"`
+	Params      *Params       `json:"params"`
+}
+
+func DefaultGenesis() *Genesis {
+	return &Genesis{
+		NetworkID:   DEFAULT_NETWORK_ID,
+		Timestamp:   GENESIS_TIMESTAMP,
+		Allocations: []*Allocation{},
+		Params:      DefaultParams(),
+	}
+}
+
+//JSONファイルからGenesisを読み込む（省略したパラメータはデフォルト値）
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g := DefaultGenesis()
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("parse genesis: %w", err)
+	}
+	if g.Params == nil {
+		g.Params = DefaultParams()
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *Genesis) Validate() error {
+	if g.NetworkID == "" {
+		return errors.New("genesis: network_id is empty")
+	}
+	if err := g.Params.Validate(); err != nil {
+		return fmt.Errorf("genesis: %w", err)
+	}
+	allocated, err := g.AllocatedSupply()
+	if err != nil {
+		return err
+	}
+	if allocated > g.Params.MaxSupply {
+		return fmt.Errorf("genesis: allocations %s exceed max_supply %s", allocated, g.Params.MaxSupply)
+	}
+	seen := make(map[string]bool)
+	for i, a := range g.Allocations {
+		if a.Address == "" || a.Address == MINING_SENDER {
+			return fmt.Errorf("genesis: allocation %d has invalid address %q", i, a.Address)
+		}
+		if seen[a.Address] {
+			return fmt.Errorf("genesis: duplicate allocation for %s", a.Address)
+		}
+		seen[a.Address] = true
+		if a.Value <= 0 {
+			return fmt.Errorf("genesis: allocation %d has non-positive value", i)
+		}
+	}
+	return nil
+}
+
+//初期残高の合計
+func (g *Genesis) AllocatedSupply() (utils.Amount, error) {
+	var total utils.Amount = 0
+	for _, a := range g.Allocations {
+		var err error
+		if total, err = total.Add(a.Value); err != nil {
+			return 0, fmt.Errorf("genesis: allocations overflow: %w", err)
+		}
+	}
+	return total, nil
+}
+
+//初期残高を配布するtransaction
+//マイニング報酬と同じ形式で、nonceは高さの0（addressは重複しないのでIDも重ならない）
+func (g *Genesis) allocationTransactions() []*Transaction {
+	transactions := make([]*Transaction, 0, len(g.Allocations))
+	for _, a := range g.Allocations {
+		if g.Params.IsUTXO() {
+			transactions = append(transactions, NewCoinbase(a.Address, a.Value, 0))
+		} else {
+			transactions = append(transactions, NewTransaction(MINING_SENDER, a.Address, a.Value, 0, 0, nil, nil))
+		}
+	}
+	return transactions
+}
+
+//ネットワークIDと全てのパラメータのhash
+//パラメータが1つでも異なるノードはGenesis Blockのhashが変わり、handshakeで拒否される
+func (g *Genesis) networkHash() [32]byte {
+	m, _ := json.Marshal(struct {
+		NetworkID string  `json:"network_id"`
+		Params    *Params `json:"params"`
+	}{
+		NetworkID: g.NetworkID,
+		Params:    g.Params,
+	})
+	return sha256.Sum256(m)
+}
+
+//Genesis Blockの作成（前のBlockのhashの代わりにネットワークIDとパラメータのhashを入れる）
+func (g *Genesis) Block() *Block {
+	b := NewBlock(0, 0, g.networkHash(), g.Params.NextTarget(nil), g.allocationTransactions())
+	b.header.version = g.Params.BlockVersion()
+	b.header.timestamp = g.Timestamp
+	b.cacheHash()
+	return b
+}
+
+func (g *Genesis) Hash() [32]byte {
+	return g.Block().Hash()
+}
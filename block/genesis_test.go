@@ -0,0 +1,28 @@
+package block
+
+import "testing"
+
+//パラメータが1つでも異なればGenesis Blockのhashが変わる
+func TestGenesisHashCoversParams(t *testing.T) {
+	base := DefaultGenesis().Hash()
+	if DefaultGenesis().Hash() != base {
+		t.Fatal("genesis hash is not deterministic")
+	}
+	changes := map[string]func(p *Params){
+		"initial_reward":            func(p *Params) { p.InitialReward += 1 },
+		"halving_interval":          func(p *Params) { p.HalvingInterval += 1 },
+		"max_supply":                func(p *Params) { p.MaxSupply += 1 },
+		"coinbase_maturity":         func(p *Params) { p.CoinbaseMaturity += 1 },
+		"max_block_bytes":           func(p *Params) { p.MaxBlockBytes += 1 },
+		"max_block_transactions":    func(p *Params) { p.MaxBlockTransactions += 1 },
+		"retarget_interval":         func(p *Params) { p.RetargetInterval += 1 },
+		"target_block_interval_sec": func(p *Params) { p.TargetBlockIntervalSec += 1 },
+	}
+	for name, change := range changes {
+		g := DefaultGenesis()
+		change(g.Params)
+		if g.Hash() == base {
+			t.Errorf("changing %s does not change the genesis hash", name)
+		}
+	}
+}
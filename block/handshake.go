@@ -0,0 +1,176 @@
+package block
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+const (
+	//ノード間のプロトコルのversion（互換性のない変更で上げる）
+	PROTOCOL_VERSION = 1
+	//接続を受け入れる最も古いversion
+	MIN_PROTOCOL_VERSION = 1
+	USER_AGENT           = "gobc:0.1.0"
+)
+
+//handshakeで相手のノードと通信できないと分かった
+var ErrIncompatiblePeer = errors.New("incompatible peer")
+
+//handshakeで交換するノードの情報
+type PeerVersion struct {
+	protocolVersion uint32
+	networkID       string
+	genesisHash     [32]byte
+	bestHeight      uint64
+	chainWork       *big.Int
+	userAgent       string
+	//他のノードから見たアドレス（host:port）
+	listenAddress string
+}
+
+func (v *PeerVersion) ProtocolVersion() uint32 {
+	return v.protocolVersion
+}
+
+func (v *PeerVersion) BestHeight() uint64 {
+	return v.bestHeight
+}
+
+func (v *PeerVersion) ChainWork() *big.Int {
+	return v.chainWork
+}
+
+func (v *PeerVersion) ListenAddress() string {
+	return v.listenAddress
+}
+
+func (v *PeerVersion) MarshalJSON() ([]byte, error) {
+	work := "0"
+	if v.chainWork != nil {
+		work = v.chainWork.Text(16)
+	}
+	return json.Marshal(struct {
+		ProtocolVersion uint32 `json:"protocol_version"`
+		NetworkID       string `json:"network_id"`
+		GenesisHash     string `json:"genesis_hash"`
+		BestHeight      uint64 `json:"best_height"`
+		ChainWork       string `json:"chain_work"`
+		UserAgent       string `json:"user_agent"`
+		ListenAddress   string `json:"listen_address"`
+	}{
+		ProtocolVersion: v.protocolVersion,
+		NetworkID:       v.networkID,
+		GenesisHash:     fmt.Sprintf("%x", v.genesisHash),
+		BestHeight:      v.bestHeight,
+		ChainWork:       work,
+		UserAgent:       v.userAgent,
+		ListenAddress:   v.listenAddress,
+	})
+}
+
+func (v *PeerVersion) UnmarshalJSON(data []byte) error {
+	var genesisHash, work string
+	w := &struct {
+		ProtocolVersion *uint32 `json:"protocol_version"`
+		NetworkID       *string `json:"network_id"`
+		GenesisHash     *string `json:"genesis_hash"`
+		BestHeight      *uint64 `json:"best_height"`
+		ChainWork       *string `json:"chain_work"`
+		UserAgent       *string `json:"user_agent"`
+		ListenAddress   *string `json:"listen_address"`
+	}{
+		ProtocolVersion: &v.protocolVersion,
+		NetworkID:       &v.networkID,
+		GenesisHash:     &genesisHash,
+		BestHeight:      &v.bestHeight,
+		ChainWork:       &work,
+		UserAgent:       &v.userAgent,
+		ListenAddress:   &v.listenAddress,
+	}
+	if err := json.Unmarshal(data, w); err != nil {
+		return err
+	}
+	if err := decodeHash(genesisHash, &v.genesisHash); err != nil {
+		return fmt.Errorf("genesis_hash: %v", err)
+	}
+	chainWork, ok := new(big.Int).SetString(work, 16)
+	if !ok || chainWork.Sign() < 0 {
+		return errors.New("chain_work: invalid value")
+	}
+	v.chainWork = chainWork
+	return nil
+}
+
+//自身の情報
+func (bc *BlockChain) LocalVersion() *PeerVersion {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	return &PeerVersion{
+		protocolVersion: PROTOCOL_VERSION,
+		networkID:       bc.networkID,
+		genesisHash:     bc.genesisHash,
+		bestHeight:      bc.LastBlock().Height(),
+		chainWork:       ChainWork(bc.chain),
+		userAgent:       USER_AGENT,
+		listenAddress:   bc.address,
+	}
+}
+
+//相手のノードと通信できるか判定するメソッド
+func (bc *BlockChain) CheckVersion(v *PeerVersion) error {
+	if v.protocolVersion < MIN_PROTOCOL_VERSION {
+		return fmt.Errorf("protocol version %d is too old (minimum %d)", v.protocolVersion, MIN_PROTOCOL_VERSION)
+	}
+	if v.networkID != bc.networkID {
+		return fmt.Errorf("network %q does not match %q", v.networkID, bc.networkID)
+	}
+	if v.genesisHash != bc.genesisHash {
+		return fmt.Errorf("genesis %x does not match %x", v.genesisHash, bc.genesisHash)
+	}
+	if !validPeerAddress(v.listenAddress) {
+		return fmt.Errorf("invalid listen address %q", v.listenAddress)
+	}
+	if v.listenAddress == bc.address {
+		return errors.New("connected to self")
+	}
+	return nil
+}
+
+//他のノードからのhandshakeを受けるメソッド（互換性があればアドレス帳に加えて自身の情報を返す）
+func (bc *BlockChain) AcceptHandshake(v *PeerVersion) (*PeerVersion, error) {
+	if err := bc.CheckVersion(v); err != nil {
+		return nil, err
+	}
+	bc.peers.AddAddress(v.listenAddress)
+	return bc.LocalVersion(), nil
+}
+
+//他のノードにhandshakeを送り、相手の情報を検証して返すメソッド
+func (bc *BlockChain) handshake(peer string) (*PeerVersion, error) {
+	m, _ := bc.LocalVersion().MarshalJSON()
+	endpoint := fmt.Sprintf("http://%s/handshake", peer)
+	res, err := peerClient().Do(bc.newPeerRequest("POST", endpoint, bytes.NewBuffer(m)))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		reason := &struct {
+			Message string `json:"message"`
+		}{}
+		_ = json.NewDecoder(res.Body).Decode(reason)
+		return nil, fmt.Errorf("%w: status %d %s", ErrIncompatiblePeer, res.StatusCode, reason.Message)
+	}
+	v := new(PeerVersion)
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProtocolViolation, err)
+	}
+	if err := bc.CheckVersion(v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIncompatiblePeer, err)
+	}
+	return v, nil
+}
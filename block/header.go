@@ -0,0 +1,147 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	BLOCK_VERSION = 1
+	//UTXO方式の台帳のBlock
+	BLOCK_VERSION_UTXO = 2
+
+	HEADER_SIZE = 4 + 8 + 8 + 32 + 32 + 32 + 8 //version + height + timestamp + previousHash + merkleRoot + target + nonce
+)
+
+//Blockのヘッダー（PoWとBlockのhashはこの部分だけを対象にする）
+type BlockHeader struct {
+	version      uint32
+	height       uint64
+	timestamp    int64
+	previousHash [32]byte
+	merkleRoot   [32]byte
+	target       [32]byte //hashがこの値以下ならPoWが成立
+	nonce        int
+}
+
+func (h *BlockHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version      uint32 `json:"version"`
+		Height       uint64 `json:"height"`
+		Timestamp    int64  `json:"timestamp"`
+		PreviousHash string `json:"previous_hash"`
+		MerkleRoot   string `json:"merkle_root"`
+		Target       string `json:"target"`
+		Nonce        int    `json:"nonce"`
+	}{
+		Version:      h.version,
+		Height:       h.height,
+		Timestamp:    h.timestamp,
+		PreviousHash: fmt.Sprintf("%x", h.previousHash),
+		MerkleRoot:   fmt.Sprintf("%x", h.merkleRoot),
+		Target:       fmt.Sprintf("%x", h.target),
+		Nonce:        h.nonce,
+	})
+}
+
+func (h *BlockHeader) UnmarshalJSON(data []byte) error {
+	var preHash, merkleRoot, target string
+	v := &struct {
+		Version      *uint32 `json:"version"`
+		Height       *uint64 `json:"height"`
+		Timestamp    *int64  `json:"timestamp"`
+		PreviousHash *string `json:"previous_hash"`
+		MerkleRoot   *string `json:"merkle_root"`
+		Target       *string `json:"target"`
+		Nonce        *int    `json:"nonce"`
+	}{
+		Version:      &h.version,
+		Height:       &h.height,
+		Timestamp:    &h.timestamp,
+		PreviousHash: &preHash,
+		MerkleRoot:   &merkleRoot,
+		Target:       &target,
+		Nonce:        &h.nonce,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := decodeHash(preHash, &h.previousHash); err != nil {
+		return fmt.Errorf("previous_hash: %v", err)
+	}
+	if err := decodeHash(merkleRoot, &h.merkleRoot); err != nil {
+		return fmt.Errorf("merkle_root: %v", err)
+	}
+	if err := decodeHash(target, &h.target); err != nil {
+		return fmt.Errorf("target: %v", err)
+	}
+	return nil
+}
+
+//64文字の16進文字列を32byteに変換
+func decodeHash(s string, out *[32]byte) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(b) != 32 {
+		return errors.New("invalid length")
+	}
+	copy(out[:], b)
+	return nil
+}
+
+func (h *BlockHeader) Version() uint32 {
+	return h.version
+}
+
+func (h *BlockHeader) Height() uint64 {
+	return h.height
+}
+
+func (h *BlockHeader) Timestamp() int64 {
+	return h.timestamp
+}
+
+func (h *BlockHeader) PreviousHash() [32]byte {
+	return h.previousHash
+}
+
+func (h *BlockHeader) MerkleRoot() [32]byte {
+	return h.merkleRoot
+}
+
+func (h *BlockHeader) Target() [32]byte {
+	return h.target
+}
+
+func (h *BlockHeader) Nonce() int {
+	return h.nonce
+}
+
+//固定長のバイナリ表現（nonceは末尾の8byte）
+func (h *BlockHeader) Bytes() []byte {
+	buf := make([]byte, HEADER_SIZE)
+	binary.BigEndian.PutUint32(buf[0:4], h.version)
+	binary.BigEndian.PutUint64(buf[4:12], h.height)
+	binary.BigEndian.PutUint64(buf[12:20], uint64(h.timestamp))
+	copy(buf[20:52], h.previousHash[:])
+	copy(buf[52:84], h.merkleRoot[:])
+	copy(buf[84:116], h.target[:])
+	binary.BigEndian.PutUint64(buf[116:124], uint64(h.nonce))
+	return buf
+}
+
+//ヘッダーのHash（BlockのHash、PoWの判定に使う）
+func (h *BlockHeader) Hash() [32]byte {
+	return sha256.Sum256(h.Bytes())
+}
+
+//PoWが成立しているか判定するメソッド
+func (h *BlockHeader) IsValidProof() bool {
+	return meetsTarget(h.Hash(), h.target)
+}
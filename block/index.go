@@ -0,0 +1,69 @@
+package block
+
+//1回のrequestで返すBlock数の上限
+const MAX_BLOCKS_PER_PAGE = 100
+
+//Blockとtransactionのindexを作り直すメソッド
+func (bc *BlockChain) rebuildIndex() {
+	bc.hashIndex = make(map[[32]byte]uint64, len(bc.chain))
+	bc.txIndex = make(map[[32]byte]txLocation)
+	bc.addressIndex = make(map[string][]txLocation)
+	for _, b := range bc.chain {
+		bc.indexBlock(b)
+	}
+}
+
+//chainの末尾に追加したBlockをindexに登録するメソッド
+func (bc *BlockChain) indexBlock(b *Block) {
+	b.cacheHash()
+	bc.hashIndex[b.Hash()] = b.Height()
+	bc.indexTransactions(b)
+}
+
+//chainの末尾から外したBlockをindexから削除するメソッド
+func (bc *BlockChain) unindexBlock(b *Block) {
+	delete(bc.hashIndex, b.Hash())
+	bc.unindexTransactions(b)
+}
+
+//最後のBlockを返すメソッド（排他あり）
+func (bc *BlockChain) Tip() *Block {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	return bc.LastBlock()
+}
+
+//高さheightのBlockを返すメソッド（存在しなければnil）
+func (bc *BlockChain) BlockByHeight(height uint64) *Block {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	if height >= uint64(len(bc.chain)) {
+		return nil
+	}
+	return bc.chain[height]
+}
+
+//hashが一致するBlockを返すメソッド（存在しなければnil）
+func (bc *BlockChain) BlockByHash(hash [32]byte) *Block {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	height, ok := bc.hashIndex[hash]
+	if !ok {
+		return nil
+	}
+	return bc.chain[height]
+}
+
+//高さfromから最大limit個のBlockを返すメソッド
+func (bc *BlockChain) Blocks(from uint64, limit int) []*Block {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	if limit <= 0 || limit > MAX_BLOCKS_PER_PAGE {
+		limit = MAX_BLOCKS_PER_PAGE
+	}
+	blocks := make([]*Block, 0, limit)
+	for h := from; h < uint64(len(bc.chain)) && len(blocks) < limit; h++ {
+		blocks = append(blocks, bc.chain[h])
+	}
+	return blocks
+}
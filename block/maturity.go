@@ -0,0 +1,69 @@
+package block
+
+import "gobc/utils"
+
+//高さheightのBlockを作る時点でマイニング報酬がまだ使えないBlock（Genesis Blockは含めない）
+//報酬はmaturity個のBlockが積まれるまで使えない
+func immatureBlocks(chain []*Block, height int, maturity uint64) []*Block {
+	from := height - int(maturity) + 1
+	if from < 1 {
+		from = 1
+	}
+	if from >= len(chain) || from > height {
+		return nil
+	}
+	to := height + 1
+	if to > len(chain) {
+		to = len(chain)
+	}
+	return chain[from:to]
+}
+
+//報酬のtransactionがaddressに送る量
+func rewardValueTo(t *Transaction, address string) utils.Amount {
+	var value utils.Amount = 0
+	if t.IsUTXO() {
+		for _, o := range t.outputs {
+			if o.address == address {
+				value += o.value
+			}
+		}
+		return value
+	}
+	if t.recipientAddress == address {
+		value = t.value
+	}
+	return value
+}
+
+//addressが受け取ったまだ使えないマイニング報酬の合計
+func (st *chainState) immatureAmount(address string) utils.Amount {
+	var total utils.Amount = 0
+	for _, b := range st.immature {
+		for _, t := range b.transactions {
+			if t.IsCoinbase() {
+				total += rewardValueTo(t, address)
+			}
+		}
+	}
+	return total
+}
+
+//出力がまだ使えないマイニング報酬のものか判定する
+func (st *chainState) isImmatureOutput(op OutPoint) bool {
+	for _, b := range st.immature {
+		for _, t := range b.transactions {
+			if t.IsCoinbase() && t.Hash() == op.TxID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//addressが受け取ったまだ使えないマイニング報酬の合計を返すメソッド（次のBlockの時点）
+func (bc *BlockChain) ImmatureAmount(address string) utils.Amount {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	return bc.confirmedState().immatureAmount(address)
+}
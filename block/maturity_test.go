@@ -0,0 +1,76 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"gobc/utils"
+	"testing"
+)
+
+//PoWが常に成立する難易度でマイナーの鍵とchainを作る
+func newTestBlockChain(t *testing.T, ledgerMode string) (*BlockChain, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := DefaultGenesis()
+	genesis.Params.InitialDifficultyBits = 0
+	genesis.Params.LedgerMode = ledgerMode
+	bc, err := NewBlockChain(utils.PublicKeyToAddress(&key.PublicKey), 0, NewMemoryStorage(), genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc, key
+}
+
+//chainの先頭に繋がるBlockを作る
+func nextTestBlock(bc *BlockChain, transactions []*Transaction) *Block {
+	b := NewBlock(0, uint64(len(bc.chain)), bc.LastBlock().Hash(), bc.params.NextTarget(bc.chain), transactions)
+	b.header.version = bc.params.BlockVersion()
+	return b
+}
+
+func signTestHash(t *testing.T, key *ecdsa.PrivateKey, tx *Transaction) *utils.Signature {
+	h := tx.Hash()
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &utils.Signature{R: r, S: s}
+}
+
+//同じBlockの報酬を使うtransactionは拒否する（アカウント方式）
+func TestRewardNotSpendableInSameBlockAccount(t *testing.T) {
+	bc, key := newTestBlockChain(t, LEDGER_ACCOUNT)
+	reward := bc.newReward(bc.params.RewardForHeight(1), 1)
+	spend := NewTransaction(bc.minerAddress, "someone", utils.COIN/2, 0, 0, &key.PublicKey, nil)
+	spend.signature = signTestHash(t, key, spend)
+
+	if _, err := bc.ReceiveBlock(nextTestBlock(bc, []*Transaction{reward, spend}), ""); err == nil {
+		t.Fatal("block spending its own reward was accepted")
+	}
+	if status, err := bc.ReceiveBlock(nextTestBlock(bc, []*Transaction{reward}), ""); err != nil || status != BLOCK_ACCEPTED {
+		t.Fatalf("block with only the reward: status %q, err %v", status, err)
+	}
+}
+
+//同じBlockの報酬の出力を使うtransactionは拒否する（UTXO方式）
+func TestRewardNotSpendableInSameBlockUTXO(t *testing.T) {
+	bc, key := newTestBlockChain(t, LEDGER_UTXO)
+	value := bc.params.RewardForHeight(1)
+	reward := bc.newReward(value, 1)
+	spend := NewUTXOTransaction(
+		[]*TxInput{NewTxInput(OutPoint{TxID: reward.Hash(), Index: 0}, &key.PublicKey, nil)},
+		[]*TxOutput{NewTxOutput(bc.minerAddress, value)},
+		0,
+	)
+	spend.inputs[0].signature = signTestHash(t, key, spend)
+
+	if _, err := bc.ReceiveBlock(nextTestBlock(bc, []*Transaction{reward, spend}), ""); err == nil {
+		t.Fatal("block spending its own reward output was accepted")
+	}
+	if status, err := bc.ReceiveBlock(nextTestBlock(bc, []*Transaction{reward}), ""); err != nil || status != BLOCK_ACCEPTED {
+		t.Fatalf("block with only the reward: status %q, err %v", status, err)
+	}
+}
@@ -0,0 +1,180 @@
+package block
+
+import (
+	"fmt"
+	"gobc/utils"
+	"log"
+	"math"
+	"sort"
+)
+
+const (
+	//Poolに保持するtransactionの合計サイズの上限（byte）
+	MAX_POOL_BYTES = 1 << 20
+	//手数料率の推定に使う直近のBlock数
+	FEE_ESTIMATE_BLOCKS = 10
+	//手数料の推定に使う一般的なtransactionのサイズ（byte）
+	TYPICAL_TRANSACTION_SIZE = 400
+)
+
+//Blockのマイニング報酬以外のtransactionの手数料の合計
+func blockFees(b *Block) (utils.Amount, error) {
+	var fees utils.Amount = 0
+	for _, t := range b.transactions {
+		if t.IsCoinbase() {
+			continue
+		}
+		var err error
+		if fees, err = fees.Add(t.fee); err != nil {
+			return 0, fmt.Errorf("fees: %w", err)
+		}
+	}
+	return fees, nil
+}
+
+func (bc *BlockChain) poolBytes() int {
+	total := 0
+	for _, t := range bc.transactionPool {
+		total += t.Size()
+	}
+	return total
+}
+
+//手数料率が最も低いtransactionのindex
+func lowestFeeRateIndex(pool []*Transaction) int {
+	lowest := -1
+	var lowestRate float64
+	for i, t := range pool {
+		if rate := t.FeeRate(); lowest < 0 || rate < lowestRate {
+			lowest, lowestRate = i, rate
+		}
+	}
+	return lowest
+}
+
+//未承認transactionを反映した状態で検証してPoolに追加するメソッド（署名はここで1度だけ検証する）
+//Poolが一杯の場合は手数料率の低いものから除外し、新しいtransactionの方が低ければ拒否する
+//除外は新しいtransactionを受け入れると決まってから行う
+func (bc *BlockChain) admitTransaction(t *Transaction) bool {
+	//Pool内の未承認transactionを反映した残高・nonceで確認（二重支払い・再送信の拒否）
+	if err := bc.pendingState().applyTransaction(t); err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+
+	size := t.Size()
+	rate := t.FeeRate()
+	poolBytes := bc.poolBytes()
+	if poolBytes+size <= MAX_POOL_BYTES {
+		bc.transactionPool = append(bc.transactionPool, t)
+		bc.savePool()
+		return true
+	}
+
+	//除外する候補を手数料率の低い順に決める（まだPoolは変えない）
+	pool := append([]*Transaction{}, bc.transactionPool...)
+	evicted := make([]*Transaction, 0)
+	for poolBytes+size > MAX_POOL_BYTES {
+		i := lowestFeeRateIndex(pool)
+		if i < 0 || pool[i].FeeRate() >= rate {
+			log.Printf("Error: transaction %s: mempool is full (fee rate %.3f is too low)", t.ID(), rate)
+			return false
+		}
+		evicted = append(evicted, pool[i])
+		poolBytes -= pool[i].Size()
+		pool = append(pool[:i:i], pool[i+1:]...)
+	}
+	//除外したtransactionに依存していたものは無効になるので、残りと新しいtransactionを検証し直す
+	st := bc.confirmedState()
+	kept := make([]*Transaction, 0, len(pool)+1)
+	invalid := make(map[*Transaction]error)
+	for _, p := range pool {
+		if err := st.applyPooledTransaction(p); err != nil {
+			invalid[p] = err
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if err := st.applyPooledTransaction(t); err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+
+	for _, e := range evicted {
+		bc.dropTransaction(e, fmt.Errorf("evicted from full mempool (fee rate %.3f < %.3f)", e.FeeRate(), rate))
+	}
+	for _, p := range pool {
+		if err, ok := invalid[p]; ok {
+			bc.dropTransaction(p, err)
+		}
+	}
+	bc.transactionPool = append(kept, t)
+	bc.savePool()
+	return true
+}
+
+//Blockに入れるtransactionを手数料率の高い順に、maxBytesとmaxCountに収まるだけ選ぶメソッド
+//nonceの順序やPool内の出力の使用など、先に入れるべきtransactionがあるものは後回しにする
+//選ばれなかったtransactionはPoolに残る
+func (bc *BlockChain) selectTransactions(maxBytes int, maxCount int) []*Transaction {
+	rates := make(map[*Transaction]float64, len(bc.transactionPool))
+	candidates := make([]*Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		rates[t] = t.FeeRate()
+		candidates = append(candidates, t)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return rates[candidates[i]] > rates[candidates[j]]
+	})
+
+	st := bc.confirmedState()
+	selected := make([]*Transaction, 0, len(candidates))
+	bytes := 0
+	for progress := true; progress && len(selected) < maxCount; {
+		progress = false
+		rest := make([]*Transaction, 0, len(candidates))
+		for _, t := range candidates {
+			size := t.Size()
+			if len(selected) >= maxCount || bytes+size > maxBytes || st.applyPooledTransaction(t) != nil {
+				rest = append(rest, t)
+				continue
+			}
+			selected = append(selected, t)
+			bytes += size
+			progress = true
+		}
+		candidates = rest
+	}
+	return selected
+}
+
+//1byteあたりの手数料（最小単位）の推定値を返すメソッド
+//直近のBlockの手数料率の中央値とし、Poolが一杯に近い場合はPool内の最低の手数料率を上回る値にする
+func (bc *BlockChain) EstimateFeeRate() float64 {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	rates := make([]float64, 0)
+	from := len(bc.chain) - FEE_ESTIMATE_BLOCKS
+	if from < 1 {
+		from = 1
+	}
+	for _, b := range bc.chain[from:] {
+		for _, t := range b.transactions {
+			if !t.IsCoinbase() {
+				rates = append(rates, t.FeeRate())
+			}
+		}
+	}
+	estimate := 0.0
+	if len(rates) > 0 {
+		sort.Float64s(rates)
+		estimate = rates[len(rates)/2]
+	}
+	if bc.poolBytes()+TYPICAL_TRANSACTION_SIZE > MAX_POOL_BYTES/2 {
+		if i := lowestFeeRateIndex(bc.transactionPool); i >= 0 {
+			estimate = math.Max(estimate, bc.transactionPool[i].FeeRate()+1)
+		}
+	}
+	return estimate
+}
@@ -0,0 +1,76 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"gobc/utils"
+	"testing"
+)
+
+//初期残高を持つ鍵とアカウント方式のchainを作る
+func newFundedTestBlockChain(t *testing.T, storage Storage) (*BlockChain, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := utils.PublicKeyToAddress(&key.PublicKey)
+	genesis := DefaultGenesis()
+	genesis.Params.InitialDifficultyBits = 0
+	genesis.Allocations = []*Allocation{{Address: address, Value: 1000 * utils.COIN}}
+	bc, err := NewBlockChain(address, 0, storage, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc, key
+}
+
+func newSignedTestTransaction(t *testing.T, key *ecdsa.PrivateKey, fee utils.Amount, nonce uint64) *Transaction {
+	tx := NewTransaction(utils.PublicKeyToAddress(&key.PublicKey), "someone", 1, fee, nonce, &key.PublicKey, nil)
+	tx.signature = signTestHash(t, key, tx)
+	return tx
+}
+
+//除外したtransactionに依存する新しいtransactionは拒否し、その場合Poolは変えない
+func TestAdmitRejectedNewcomerKeepsPool(t *testing.T) {
+	bc, key := newFundedTestBlockChain(t, NewMemoryStorage())
+	//Poolを一杯にする（受け入れ時の検証を省いて直接入れる）
+	var nonce uint64
+	for bytes := 0; ; nonce++ {
+		tx := newSignedTestTransaction(t, key, 1, nonce)
+		if bytes += tx.Size(); bytes > MAX_POOL_BYTES {
+			break
+		}
+		bc.transactionPool = append(bc.transactionPool, tx)
+	}
+	before := len(bc.transactionPool)
+
+	//手数料率は高いが、除外される低い手数料率のtransactionのnonceの続きなので受け入れられない
+	if bc.admitTransaction(newSignedTestTransaction(t, key, 1000, nonce)) {
+		t.Fatal("newcomer depending on an evicted transaction was accepted")
+	}
+	if len(bc.transactionPool) != before || len(bc.droppedTransactions) != 0 {
+		t.Fatalf("pool changed: %d -> %d transactions, %d dropped", before, len(bc.transactionPool), len(bc.droppedTransactions))
+	}
+}
+
+//Poolの署名は受け入れる時にしか検証しないので、保存されていた不正な署名のtransactionは読み込む時に除外する
+func TestLoadPoolDropsInvalidSignatures(t *testing.T) {
+	storage := NewMemoryStorage()
+	bc, key := newFundedTestBlockChain(t, storage)
+	valid := newSignedTestTransaction(t, key, 1, 0)
+	forged := newSignedTestTransaction(t, key, 1, 1)
+	forged.recipientAddress = "attacker"
+	if !bc.admitTransaction(valid) || bc.admitTransaction(forged) {
+		t.Fatal("admission did not check the signature")
+	}
+	storage.SavePool([]*Transaction{valid, forged})
+
+	bc, err := NewBlockChain(bc.minerAddress, 0, storage, bc.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool := bc.TransactionPool(); len(pool) != 1 || pool[0].Hash() != valid.Hash() {
+		t.Fatalf("pool = %v", pool)
+	}
+}
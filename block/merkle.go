@@ -0,0 +1,135 @@
+package block
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+//Merkle証明の1段分（兄弟ノードのhashと、それが左右どちらにあるか）
+type MerkleProofStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+//transactionがBlockに含まれることの証明
+type MerkleProof struct {
+	TxID       string             `json:"tx_id"`
+	MerkleRoot string             `json:"merkle_root"`
+	Steps      []*MerkleProofStep `json:"steps"`
+}
+
+func transactionHashes(transactions []*Transaction) [][32]byte {
+	hashes := make([][32]byte, len(transactions))
+	for i, t := range transactions {
+		hashes[i] = t.Hash()
+	}
+	return hashes
+}
+
+//内部ノードのhash（葉と区別するため先頭に0x01を付ける）
+func merkleParent(left [32]byte, right [32]byte) [32]byte {
+	buf := make([]byte, 0, 65)
+	buf = append(buf, 0x01)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+	return sha256.Sum256(buf)
+}
+
+//1段上のノード（奇数個の場合、最後のノードはそのまま上に上げる）
+func merkleLevel(level [][32]byte) [][32]byte {
+	next := make([][32]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, merkleParent(level[i], level[i+1]))
+	}
+	return next
+}
+
+//hashの列からMerkle rootを計算（空の場合はゼロ）
+func MerkleRoot(hashes [][32]byte) [32]byte {
+	if len(hashes) == 0 {
+		return [32]byte{}
+	}
+	level := hashes
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+	return level[0]
+}
+
+//index番目のhashのMerkle証明を作成
+func NewMerkleProof(hashes [][32]byte, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(hashes) {
+		return nil, errors.New("index out of range")
+	}
+	proof := &MerkleProof{
+		TxID:  fmt.Sprintf("%x", hashes[index]),
+		Steps: make([]*MerkleProofStep, 0),
+	}
+	level := hashes
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Steps = append(proof.Steps, &MerkleProofStep{
+				Hash: fmt.Sprintf("%x", level[sibling]),
+				Left: sibling < index,
+			})
+		}
+		level = merkleLevel(level)
+		index /= 2
+	}
+	proof.MerkleRoot = fmt.Sprintf("%x", level[0])
+	return proof, nil
+}
+
+//Block内のtransactionのMerkle証明を作成するメソッド
+func (b *Block) MerkleProof(txID [32]byte) (*MerkleProof, error) {
+	hashes := transactionHashes(b.transactions)
+	for i, h := range hashes {
+		if h == txID {
+			return NewMerkleProof(hashes, i)
+		}
+	}
+	return nil, errors.New("transaction not found in block")
+}
+
+//証明からrootを計算し直し、merkleRootと一致するか判定
+func VerifyMerkleProof(proof *MerkleProof, merkleRoot [32]byte) bool {
+	var h [32]byte
+	if err := decodeHash(proof.TxID, &h); err != nil {
+		return false
+	}
+	for _, step := range proof.Steps {
+		var sibling [32]byte
+		if err := decodeHash(step.Hash, &sibling); err != nil {
+			return false
+		}
+		if step.Left {
+			h = merkleParent(sibling, h)
+		} else {
+			h = merkleParent(h, sibling)
+		}
+	}
+	return h == merkleRoot
+}
+
+//indexからtransactionを探し、含まれるBlockとMerkle証明を返すメソッド
+func (bc *BlockChain) TransactionProof(txID [32]byte) (*Block, *MerkleProof, error) {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	loc, ok := bc.txIndex[txID]
+	if !ok {
+		return nil, nil, errors.New("transaction not found in chain")
+	}
+	b := bc.chain[loc.height]
+	proof, err := NewMerkleProof(transactionHashes(b.transactions), loc.index)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, proof, nil
+}
@@ -0,0 +1,23 @@
+package block
+
+import "testing"
+
+//indexから探したtransactionの証明は含まれるBlockのmerkleRootで検証できる
+func TestTransactionProofUsesIndex(t *testing.T) {
+	bc, _ := newTestBlockChain(t, LEDGER_ACCOUNT)
+	reward := bc.newReward(bc.params.RewardForHeight(1), 1)
+	if status, err := bc.ReceiveBlock(nextTestBlock(bc, []*Transaction{reward}), ""); err != nil || status != BLOCK_ACCEPTED {
+		t.Fatalf("status %q, err %v", status, err)
+	}
+
+	b, proof, err := bc.TransactionProof(reward.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Height() != 1 || !VerifyMerkleProof(proof, b.header.merkleRoot) {
+		t.Fatalf("proof from block %d does not verify", b.Height())
+	}
+	if _, _, err := bc.TransactionProof([32]byte{1}); err == nil {
+		t.Fatal("proof for an unknown transaction")
+	}
+}
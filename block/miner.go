@@ -0,0 +1,105 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//workerが中断・計測を確認する間隔（hash回数）
+const MINER_CHECK_INTERVAL = 4096
+
+//複数のgoroutineでnonceを探索するマイナー
+type Miner struct {
+	workers  int
+	hashrate uint64 //直近のhash/秒（float64のbit列）
+}
+
+func NewMiner(workers int) *Miner {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Miner{workers: workers}
+}
+
+func (m *Miner) Workers() int {
+	return m.workers
+}
+
+//直近のhashrate（hash/秒）
+func (m *Miner) Hashrate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&m.hashrate))
+}
+
+func (m *Miner) setHashrate(hashes uint64, start time.Time) {
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	atomic.StoreUint64(&m.hashrate, math.Float64bits(float64(hashes)/elapsed))
+}
+
+//bのnonceを探索するメソッド
+//worker iはnonce i, i+workers, i+2*workers ... を調べ、abortが閉じられたら中断してfalseを返す
+func (m *Miner) Mine(b *Block, abort <-chan struct{}) (int, bool) {
+	//ヘッダーのバイナリのうちnonce（末尾8byte）以外は固定
+	prefix := b.header.Bytes()[:HEADER_SIZE-8]
+	target := b.Target()
+	result := make(chan int, m.workers)
+	done := make(chan struct{})
+	var hashes uint64 = 0
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func(first int) {
+			defer wg.Done()
+			buf := make([]byte, len(prefix)+8)
+			copy(buf, prefix)
+			count := 0
+			for nonce := first; ; nonce += m.workers {
+				binary.BigEndian.PutUint64(buf[len(prefix):], uint64(nonce))
+				if meetsTarget(sha256.Sum256(buf), target) {
+					atomic.AddUint64(&hashes, uint64(count+1))
+					result <- nonce
+					return
+				}
+				count += 1
+				if count == MINER_CHECK_INTERVAL {
+					atomic.AddUint64(&hashes, uint64(count))
+					count = 0
+					select {
+					case <-done:
+						return
+					default:
+					}
+				}
+			}
+		}(i)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case nonce := <-result:
+			close(done)
+			wg.Wait()
+			m.setHashrate(atomic.LoadUint64(&hashes), start)
+			return nonce, true
+		case <-abort:
+			close(done)
+			wg.Wait()
+			m.setHashrate(atomic.LoadUint64(&hashes), start)
+			log.Println("action=mining, status=aborted")
+			return 0, false
+		case <-ticker.C:
+			m.setHashrate(atomic.LoadUint64(&hashes), start)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package block
+
+import (
+	"fmt"
+	"gobc/utils"
+	"math"
+	"strings"
+)
+
+const (
+	TARGET_BLOCK_INTERVAL_SEC = 10
+	RETARGET_INTERVAL         = 10
+	MAX_BLOCK_BYTES           = 1 << 18
+	MAX_BLOCK_TRANSACTIONS    = 1000
+	HALVING_INTERVAL          = 210000
+	MAX_SUPPLY                = 21000000 * utils.COIN
+	COINBASE_MATURITY         = 10
+	//base58のアドレスの最大の長さ（25byte）
+	MAX_ADDRESS_LENGTH = 34
+
+	//台帳の方式（アカウントの残高とnonce、またはBitcoinのような未使用出力）
+	LEDGER_ACCOUNT = "account"
+	LEDGER_UTXO    = "utxo"
+)
+
+//ネットワークごとのパラメータ
+type Params struct {
+	//最初のtargetの先頭の0のbit数（最も易しい難易度）
+	InitialDifficultyBits uint `json:"initial_difficulty_bits"`
+	//目標とするBlockの生成間隔
+	TargetBlockIntervalSec int64 `json:"target_block_interval_sec"`
+	//何Blockごとに難易度を調整するか
+	RetargetInterval int `json:"retarget_interval"`
+	//台帳の方式（Genesis Blockから全Blockのversionで区別する）
+	LedgerMode string `json:"ledger_mode"`
+	//Blockのサイズ（byte）とtransaction数（マイニング報酬を含む）の上限
+	MaxBlockBytes        int `json:"max_block_bytes"`
+	MaxBlockTransactions int `json:"max_block_transactions"`
+	//最初のマイニング報酬と、報酬が半分になるBlock数の間隔（0なら半減しない）
+	InitialReward   utils.Amount `json:"initial_reward"`
+	HalvingInterval uint64       `json:"halving_interval"`
+	//発行量の上限（Genesis Blockの配布を含み、報酬はこれを超えないよう減らす）
+	MaxSupply utils.Amount `json:"max_supply"`
+	//マイニング報酬が使えるようになるまでに必要な後続のBlock数
+	CoinbaseMaturity uint64 `json:"coinbase_maturity"`
+	//Genesis Blockで配布した量（JSONには含めず、Genesisから設定する）
+	allocated utils.Amount
+}
+
+func DefaultParams() *Params {
+	return &Params{
+		InitialDifficultyBits:  4 * MINING_DIFFICULTY,
+		TargetBlockIntervalSec: TARGET_BLOCK_INTERVAL_SEC,
+		RetargetInterval:       RETARGET_INTERVAL,
+		LedgerMode:             LEDGER_ACCOUNT,
+		MaxBlockBytes:          MAX_BLOCK_BYTES,
+		MaxBlockTransactions:   MAX_BLOCK_TRANSACTIONS,
+		InitialReward:          MINING_REWARD,
+		HalvingInterval:        HALVING_INTERVAL,
+		MaxSupply:              MAX_SUPPLY,
+		CoinbaseMaturity:       COINBASE_MATURITY,
+	}
+}
+
+func (p *Params) IsUTXO() bool {
+	return p.LedgerMode == LEDGER_UTXO
+}
+
+//台帳の方式に対応するBlockのversion
+func (p *Params) BlockVersion() uint32 {
+	if p.IsUTXO() {
+		return BLOCK_VERSION_UTXO
+	}
+	return BLOCK_VERSION
+}
+
+//マイニング報酬のtransactionを作るメソッド
+func (p *Params) newReward(address string, value utils.Amount, height uint64) *Transaction {
+	if p.IsUTXO() {
+		return NewCoinbase(address, value, height)
+	}
+	return NewTransaction(MINING_SENDER, address, value, 0, height, nil, nil)
+}
+
+//マイニング報酬のtransactionの最大のサイズ（アドレスの長さ、金額、高さを最大にして見積もる）
+func (p *Params) maxRewardSize() int {
+	return p.newReward(strings.Repeat("z", MAX_ADDRESS_LENGTH), utils.MAX_AMOUNT, math.MaxUint64).Size()
+}
+
+//パラメータが使える値か検証するメソッド（0除算や作れないBlockになる値を拒否する）
+func (p *Params) Validate() error {
+	if p.LedgerMode != LEDGER_ACCOUNT && p.LedgerMode != LEDGER_UTXO {
+		return fmt.Errorf("unknown ledger mode %q", p.LedgerMode)
+	}
+	if p.InitialDifficultyBits > 255 {
+		return fmt.Errorf("initial_difficulty_bits %d exceeds 255", p.InitialDifficultyBits)
+	}
+	if p.TargetBlockIntervalSec < 1 {
+		return fmt.Errorf("target_block_interval_sec %d must be at least 1", p.TargetBlockIntervalSec)
+	}
+	if p.RetargetInterval < 2 {
+		return fmt.Errorf("retarget_interval %d must be at least 2", p.RetargetInterval)
+	}
+	//ヘッダーとマイニング報酬だけのBlockが入らなければマイニングできない
+	if min := HEADER_SIZE + p.maxRewardSize(); p.MaxBlockBytes < min {
+		return fmt.Errorf("max_block_bytes %d is smaller than a header and a reward (%d)", p.MaxBlockBytes, min)
+	}
+	if p.MaxBlockTransactions < 1 {
+		return fmt.Errorf("max_block_transactions %d must be at least 1", p.MaxBlockTransactions)
+	}
+	if p.InitialReward < 0 {
+		return fmt.Errorf("initial_reward %s is negative", p.InitialReward)
+	}
+	if p.MaxSupply < 0 {
+		return fmt.Errorf("max_supply %s is negative", p.MaxSupply)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package block
+
+import (
+	"gobc/utils"
+	"testing"
+)
+
+func TestParamsValidate(t *testing.T) {
+	for _, ledgerMode := range []string{LEDGER_ACCOUNT, LEDGER_UTXO} {
+		base := DefaultParams()
+		base.LedgerMode = ledgerMode
+		minBytes := HEADER_SIZE + base.maxRewardSize()
+		cases := []struct {
+			name   string
+			change func(p *Params)
+			valid  bool
+		}{
+			{"default", func(p *Params) {}, true},
+			{"retarget interval 1", func(p *Params) { p.RetargetInterval = 1 }, false},
+			{"retarget interval 2", func(p *Params) { p.RetargetInterval = 2 }, true},
+			{"block interval 0", func(p *Params) { p.TargetBlockIntervalSec = 0 }, false},
+			{"difficulty bits 256", func(p *Params) { p.InitialDifficultyBits = 256 }, false},
+			{"only header fits", func(p *Params) { p.MaxBlockBytes = HEADER_SIZE + 1 }, false},
+			{"reward does not fit", func(p *Params) { p.MaxBlockBytes = minBytes - 1 }, false},
+			{"header and reward fit", func(p *Params) { p.MaxBlockBytes = minBytes }, true},
+			{"no transactions", func(p *Params) { p.MaxBlockTransactions = 0 }, false},
+			{"negative reward", func(p *Params) { p.InitialReward = -1 }, false},
+			{"negative max supply", func(p *Params) { p.MaxSupply = -1 }, false},
+		}
+		for _, c := range cases {
+			p := *base
+			c.change(&p)
+			if err := p.Validate(); (err == nil) != c.valid {
+				t.Errorf("%s %s: err = %v, want valid %v", ledgerMode, c.name, err, c.valid)
+			}
+		}
+	}
+}
+
+//Genesis Blockの配布も発行量の上限に含める
+func TestGenesisAllocationsWithinMaxSupply(t *testing.T) {
+	g := DefaultGenesis()
+	g.Params.MaxSupply = 100 * utils.COIN
+	g.Allocations = []*Allocation{{Address: "a", Value: 60 * utils.COIN}, {Address: "b", Value: 50 * utils.COIN}}
+	if err := g.Validate(); err == nil {
+		t.Fatal("allocations over max_supply were accepted")
+	}
+
+	g.Allocations = g.Allocations[:1]
+	if err := g.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBlockChain("miner", 0, NewMemoryStorage(), g); err != nil {
+		t.Fatal(err)
+	}
+	if supply := g.Params.SupplyAt(1000); supply != 40*utils.COIN {
+		t.Fatalf("mined supply = %s, want 40", supply)
+	}
+}
@@ -0,0 +1,416 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gobc/utils"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	PEERS_FILE = "peers.json"
+	//接続を保つ他のノードの数
+	TARGET_OUTBOUND_PEERS = 8
+	//アドレス帳に保持するノード数の上限
+	MAX_KNOWN_PEERS = 1000
+	//GET /peersで返すノード数の上限
+	MAX_PEERS_PER_RESPONSE = 100
+	//連続して応答がなければアドレス帳から外す回数（seedは外さない）
+	MAX_PEER_FAILURES = 5
+)
+
+//ノードの探し方の設定
+type PeerConfig struct {
+	//他のノードから見た自身のアドレス（host:port）
+	Address string
+	//最初に接続するノード
+	Seeds          []string
+	TargetOutbound int
+	//同じLAN内のIPとportを走査してノードを探すか（ローカルでの開発用）
+	Scan bool
+	//アドレス帳の保存先（空なら保存しない）
+	BookPath string
+}
+
+//アドレス帳のノード
+type knownPeer struct {
+	address string
+	//最後に応答があった時刻（一度もなければ0）
+	lastSeen int64
+	//連続して応答がなかった回数
+	failures int
+}
+
+func (p *knownPeer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address  string `json:"address"`
+		LastSeen int64  `json:"last_seen"`
+		Failures int    `json:"failures"`
+	}{
+		Address:  p.address,
+		LastSeen: p.lastSeen,
+		Failures: p.failures,
+	})
+}
+
+func (p *knownPeer) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		Address  *string `json:"address"`
+		LastSeen *int64  `json:"last_seen"`
+		Failures *int    `json:"failures"`
+	}{
+		Address:  &p.address,
+		LastSeen: &p.lastSeen,
+		Failures: &p.failures,
+	}
+	return json.Unmarshal(data, v)
+}
+
+//アドレス帳と接続中のノードを管理する
+type PeerManager struct {
+	config PeerConfig
+	book   map[string]*knownPeer
+	//接続中のノード（ブロックやtransactionを送る相手）
+	outbound []string
+	mutex    sync.Mutex
+	//Refreshを同時に1つだけ実行する
+	mutexRefresh sync.Mutex
+	//接続中のノードのhandshakeの情報
+	versions map[string]*PeerVersion
+	//不正な行為の点数とban
+	scores map[string]*PeerScore
+	//他のノードへのrequestを作る関数（ネットワークIDなどを付ける）
+	newRequest func(method string, endpoint string, body io.Reader) *http.Request
+	//ノードとhandshakeする関数（nilならhandshakeしない）
+	handshake func(peer string) (*PeerVersion, error)
+}
+
+//PeerManagerの作成（BookPathにアドレス帳があれば読み込む）
+func NewPeerManager(config PeerConfig) *PeerManager {
+	if config.TargetOutbound <= 0 {
+		config.TargetOutbound = TARGET_OUTBOUND_PEERS
+	}
+	pm := &PeerManager{
+		config:   config,
+		book:     make(map[string]*knownPeer),
+		versions: make(map[string]*PeerVersion),
+		scores:   make(map[string]*PeerScore),
+		newRequest: func(method string, endpoint string, body io.Reader) *http.Request {
+			req, _ := http.NewRequest(method, endpoint, body)
+			return req
+		},
+	}
+	if err := pm.load(); err != nil {
+		log.Printf("Error: load address book: %v", err)
+	}
+	for _, seed := range config.Seeds {
+		pm.AddAddress(seed)
+	}
+	return pm
+}
+
+func (pm *PeerManager) Address() string {
+	return pm.config.Address
+}
+
+//接続中のノードを返すメソッド
+func (pm *PeerManager) Outbound() []string {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	return append([]string{}, pm.outbound...)
+}
+
+//接続中のノードのhandshakeの情報（handshakeしていなければnil）
+func (pm *PeerManager) Version(peer string) *PeerVersion {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	return pm.versions[peer]
+}
+
+func validPeerAddress(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return false
+	}
+	p, err := strconv.Atoi(port)
+	return err == nil && p > 0 && p <= 65535
+}
+
+func (pm *PeerManager) isSeed(address string) bool {
+	for _, seed := range pm.config.Seeds {
+		if seed == address {
+			return true
+		}
+	}
+	return false
+}
+
+//アドレス帳にノードを追加するメソッド（既にあるもの、自身、不正なアドレスは無視する）
+func (pm *PeerManager) AddAddress(address string) {
+	if address == pm.config.Address || !validPeerAddress(address) {
+		return
+	}
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	if _, ok := pm.book[address]; ok {
+		return
+	}
+	if len(pm.book) >= MAX_KNOWN_PEERS && !pm.evictOne() {
+		return
+	}
+	pm.book[address] = &knownPeer{address: address}
+}
+
+//アドレス帳から最も応答のないノードを1つ外すメソッド（seedと接続中のノードは外さない）
+func (pm *PeerManager) evictOne() bool {
+	var worst *knownPeer = nil
+	for _, p := range pm.book {
+		if pm.isSeed(p.address) || pm.isOutbound(p.address) {
+			continue
+		}
+		if worst == nil || p.failures > worst.failures || (p.failures == worst.failures && p.lastSeen < worst.lastSeen) {
+			worst = p
+		}
+	}
+	if worst == nil {
+		return false
+	}
+	delete(pm.book, worst.address)
+	return true
+}
+
+func (pm *PeerManager) isOutbound(address string) bool {
+	for _, p := range pm.outbound {
+		if p == address {
+			return true
+		}
+	}
+	return false
+}
+
+//他のノードに教えるアドレス（接続中のノードと、応答があったことのあるノードの新しい順）
+func (pm *PeerManager) KnownPeers() []string {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	peers := append([]string{}, pm.outbound...)
+	seen := make([]*knownPeer, 0, len(pm.book))
+	for _, p := range pm.book {
+		if p.lastSeen > 0 && !pm.isOutbound(p.address) {
+			seen = append(seen, p)
+		}
+	}
+	sort.Slice(seen, func(i, j int) bool {
+		return seen[i].lastSeen > seen[j].lastSeen
+	})
+	for _, p := range seen {
+		peers = append(peers, p.address)
+	}
+	if len(peers) > MAX_PEERS_PER_RESPONSE {
+		peers = peers[:MAX_PEERS_PER_RESPONSE]
+	}
+	return peers
+}
+
+//接続中のノードを確認し、TargetOutboundに足りない分をアドレス帳から補うメソッド
+//確認したノードから教えてもらったアドレスはアドレス帳に追加する
+func (pm *PeerManager) Refresh() []string {
+	pm.mutexRefresh.Lock()
+	defer pm.mutexRefresh.Unlock()
+
+	if pm.config.Scan {
+		for _, address := range pm.scan() {
+			pm.AddAddress(address)
+		}
+	}
+	for _, seed := range pm.config.Seeds {
+		pm.AddAddress(seed)
+	}
+
+	alive := make([]string, 0, pm.config.TargetOutbound)
+	versions := make(map[string]*PeerVersion)
+	for _, peer := range pm.Outbound() {
+		if pm.IsBanned(peer) {
+			continue
+		}
+		if v, err := pm.connect(peer); err == nil {
+			alive = append(alive, peer)
+			versions[peer] = v
+		}
+	}
+	//応答のないノードで時間がかからないよう、1回に試す数は目標の2倍まで
+	for i, peer := range pm.candidates(alive) {
+		if len(alive) >= pm.config.TargetOutbound || i >= 2*pm.config.TargetOutbound {
+			break
+		}
+		if v, err := pm.connect(peer); err == nil {
+			alive = append(alive, peer)
+			versions[peer] = v
+		}
+	}
+
+	pm.mutex.Lock()
+	pm.outbound = alive
+	pm.versions = versions
+	pm.mutex.Unlock()
+	if err := pm.save(); err != nil {
+		log.Printf("Error: store address book: %v", err)
+	}
+	return append([]string{}, alive...)
+}
+
+//接続を試すノード（失敗の少ない順、最近応答があった順）
+func (pm *PeerManager) candidates(exclude []string) []string {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	excluded := make(map[string]bool)
+	for _, address := range exclude {
+		excluded[address] = true
+	}
+	peers := make([]*knownPeer, 0, len(pm.book))
+	for _, p := range pm.book {
+		if !excluded[p.address] && !pm.isBanned(p.address) {
+			peers = append(peers, p)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].failures != peers[j].failures {
+			return peers[i].failures < peers[j].failures
+		}
+		return peers[i].lastSeen > peers[j].lastSeen
+	})
+	addresses := make([]string, len(peers))
+	for i, p := range peers {
+		addresses[i] = p.address
+	}
+	return addresses
+}
+
+//ノードとhandshakeしてからGET /peersでアドレスを交換し、結果をアドレス帳に記録するメソッド
+//互換性のないノードはアドレス帳から外す
+func (pm *PeerManager) connect(peer string) (*PeerVersion, error) {
+	var v *PeerVersion = nil
+	var err error = nil
+	if pm.handshake != nil {
+		v, err = pm.handshake(peer)
+	}
+	var addresses []string
+	if err == nil {
+		addresses, err = pm.fetchPeers(peer)
+	}
+
+	pm.mutex.Lock()
+	if p, ok := pm.book[peer]; ok {
+		if err != nil {
+			p.failures += 1
+			if errors.Is(err, ErrIncompatiblePeer) || (p.failures >= MAX_PEER_FAILURES && !pm.isSeed(peer)) {
+				delete(pm.book, peer)
+			}
+		} else {
+			p.failures = 0
+			p.lastSeen = time.Now().UnixNano()
+		}
+	}
+	pm.mutex.Unlock()
+	if err != nil {
+		log.Printf("Error: peer %s: %v", peer, err)
+		pm.penalize(peer, err)
+		return nil, err
+	}
+	for _, address := range addresses {
+		pm.AddAddress(address)
+	}
+	return v, nil
+}
+
+func (pm *PeerManager) fetchPeers(peer string) ([]string, error) {
+	endpoint := fmt.Sprintf("http://%s/peers", peer)
+	res, err := peerClient().Do(pm.newRequest("GET", endpoint, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", res.StatusCode)
+	}
+	v := &struct {
+		Peers []string `json:"peers"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProtocolViolation, err)
+	}
+	if len(v.Peers) > MAX_PEERS_PER_RESPONSE {
+		return nil, fmt.Errorf("%w: too many peers in response", ErrProtocolViolation)
+	}
+	return v.Peers, nil
+}
+
+//自身のアドレスの周辺のIPとportを走査してノードを探す
+func (pm *PeerManager) scan() []string {
+	host, port, err := net.SplitHostPort(pm.config.Address)
+	if err != nil {
+		return nil
+	}
+	p, _ := strconv.Atoi(port)
+	return utils.FindNeighbors(host, uint16(p), IP_RANGE_START, IP_RANGE_END, PORT_RANGE_START, PORT_RANGE_END)
+}
+
+func (pm *PeerManager) load() error {
+	if pm.config.BookPath == "" {
+		return nil
+	}
+	m, err := os.ReadFile(pm.config.BookPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v := &struct {
+		Peers []*knownPeer `json:"peers"`
+	}{}
+	if err := json.Unmarshal(m, v); err != nil {
+		return err
+	}
+	for _, p := range v.Peers {
+		if validPeerAddress(p.address) && p.address != pm.config.Address {
+			pm.book[p.address] = p
+		}
+	}
+	log.Printf("action=load_peers, peers=%d", len(pm.book))
+	return nil
+}
+
+func (pm *PeerManager) save() error {
+	if pm.config.BookPath == "" {
+		return nil
+	}
+	pm.mutex.Lock()
+	peers := make([]*knownPeer, 0, len(pm.book))
+	for _, p := range pm.book {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].address < peers[j].address
+	})
+	m, err := json.Marshal(struct {
+		Peers []*knownPeer `json:"peers"`
+	}{
+		Peers: peers,
+	})
+	pm.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(pm.config.BookPath, m)
+}
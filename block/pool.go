@@ -0,0 +1,136 @@
+package block
+
+import (
+	"encoding/json"
+	"gobc/utils"
+	"log"
+	"time"
+)
+
+const MAX_DROPPED_TRANSACTIONS = 100
+
+//Poolから除外されたtransactionとその理由
+type DroppedTransaction struct {
+	transaction *Transaction
+	reason      string
+	timestamp   int64
+}
+
+func (d *DroppedTransaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID          string       `json:"id"`
+		Reason      string       `json:"reason"`
+		Timestamp   int64        `json:"timestamp"`
+		Transaction *Transaction `json:"transaction"`
+	}{
+		ID:          d.transaction.ID(),
+		Reason:      d.reason,
+		Timestamp:   d.timestamp,
+		Transaction: d.transaction,
+	})
+}
+
+//除外されたtransactionの一覧を返すメソッド
+func (bc *BlockChain) DroppedTransactions() []*DroppedTransaction {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	return append([]*DroppedTransaction{}, bc.droppedTransactions...)
+}
+
+//除外したtransactionを記録するメソッド（古いものから捨てる）
+func (bc *BlockChain) dropTransaction(t *Transaction, reason error) {
+	log.Printf("action=drop_transaction, id=%s, reason=%v", t.ID(), reason)
+	bc.droppedTransactions = append(bc.droppedTransactions, &DroppedTransaction{
+		transaction: t,
+		reason:      reason.Error(),
+		timestamp:   time.Now().UnixNano(),
+	})
+	if over := len(bc.droppedTransactions) - MAX_DROPPED_TRANSACTIONS; over > 0 {
+		bc.droppedTransactions = bc.droppedTransactions[over:]
+	}
+}
+
+//chainを適用した状態の上に変更を重ねられる状態を作るメソッド（次のBlockの時点で検証する）
+func (bc *BlockChain) confirmedState() *chainState {
+	st := newOverlayState(bc.state)
+	st.immature = immatureBlocks(bc.chain, len(bc.chain), bc.params.CoinbaseMaturity)
+	return st
+}
+
+//chainにPoolの未承認transactionを適用した状態を作るメソッド
+func (bc *BlockChain) pendingState() *chainState {
+	st := bc.confirmedState()
+	for _, t := range bc.transactionPool {
+		_ = st.transfer(t)
+	}
+	return st
+}
+
+//Blockに入ったtransactionをPoolから削除するメソッド
+func (bc *BlockChain) removeFromPool(transactions []*Transaction) {
+	included := make(map[[32]byte]bool)
+	for _, t := range transactions {
+		included[t.Hash()] = true
+	}
+	pool := make([]*Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		if !included[t.Hash()] {
+			pool = append(pool, t)
+		}
+	}
+	bc.transactionPool = pool
+	bc.savePool()
+}
+
+//chainの状態に対してPoolを先頭から検証し直し、無効になったtransactionを理由とともに除外するメソッド
+func (bc *BlockChain) prunePool() {
+	st := bc.confirmedState()
+	pool := make([]*Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		if err := st.applyPooledTransaction(t); err != nil {
+			bc.dropTransaction(t, err)
+			continue
+		}
+		pool = append(pool, t)
+	}
+	if len(pool) != len(bc.transactionPool) {
+		bc.transactionPool = pool
+		bc.savePool()
+	}
+}
+
+//次のBlockのテンプレートを作るメソッド（nonceはPoWで求める）
+//無効になったtransactionをPoolから除外し、手数料率の高い順に並べて最後にマイニング報酬（手数料を含む）を追加する
+//chainの先頭が変わると閉じられるchannelも返す
+func (bc *BlockChain) assembleBlock() (*Block, <-chan struct{}) {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	bc.prunePool()
+	//headerとマイニング報酬の分を除いた容量に収まるだけ選ぶ
+	height := len(bc.chain)
+	rewardSize := bc.newReward(utils.MAX_AMOUNT, uint64(height)).Size()
+	selected := bc.selectTransactions(bc.params.MaxBlockBytes-HEADER_SIZE-rewardSize, bc.params.MaxBlockTransactions-1)
+	transactions := make([]*Transaction, 0, len(selected)+1)
+	var fees utils.Amount = 0
+	for _, t := range selected {
+		c := *t
+		transactions = append(transactions, &c)
+		fees += t.fee
+	}
+	//ネットワークからマイナーへのTransaction追加
+	transactions = append(transactions, bc.newReward(bc.params.RewardForHeight(uint64(height))+fees, uint64(height)))
+	b := NewBlock(0, uint64(height), bc.LastBlock().Hash(), bc.params.NextTarget(bc.chain), transactions)
+	b.header.version = bc.params.BlockVersion()
+	//時計が遅れていてもmedian-time-pastより後のtimestampにする
+	if mtp := MedianTimePast(bc.chain); b.header.timestamp <= mtp {
+		b.header.timestamp = mtp + 1
+	}
+	return b, bc.tipChanged
+}
+
+//マイナーへの報酬のtransactionを作るメソッド
+//nonceにはBlockの高さを入れてIDが重複しないようにする
+func (bc *BlockChain) newReward(value utils.Amount, height uint64) *Transaction {
+	return bc.params.newReward(bc.minerAddress, value, height)
+}
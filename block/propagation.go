@@ -0,0 +1,88 @@
+package block
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	//他のノードへのrequestのタイムアウト
+	PEER_REQUEST_TIMEOUT_SEC = 10
+
+	//他のノードから受け取ったBlockの扱い
+	BLOCK_ACCEPTED = "accepted" //chainの先頭に繋げた
+	BLOCK_KNOWN    = "known"    //既にchainにある
+	BLOCK_STALE    = "stale"    //先頭に繋がらず、chainより高くもない
+	BLOCK_SYNCING  = "syncing"  //送信元のノードから祖先を取得して同期する
+)
+
+func peerClient() *http.Client {
+	return &http.Client{Timeout: PEER_REQUEST_TIMEOUT_SEC * time.Second}
+}
+
+//Blockを他のノードに送るメソッド（exceptは送信元のノードなど送らないノード）
+func (bc *BlockChain) broadcastBlock(b *Block, except string) {
+	m, _ := b.MarshalJSON()
+	for _, node := range bc.Neighbors() {
+		if node == except {
+			continue
+		}
+		endpoint := fmt.Sprintf("http://%s/blocks", node)
+		res, err := peerClient().Do(bc.newPeerRequest("POST", endpoint, bytes.NewBuffer(m)))
+		if err != nil {
+			log.Printf("Error: send block to %s: %v", node, err)
+			continue
+		}
+		res.Body.Close()
+		log.Printf("action=broadcast_block, node=%s, height=%d, status=%d", node, b.Height(), res.StatusCode)
+	}
+}
+
+//他のノードから受け取ったBlockを処理するメソッド
+//chainの先頭に繋がるものは検証して追加し、chainより高い場合はfrom（不明なら接続中のノード）と同期して祖先を取得する
+func (bc *BlockChain) ReceiveBlock(b *Block, from string) (string, error) {
+	if err := checkFutureTime([]*Block{b}, time.Now()); err != nil {
+		return "", err
+	}
+
+	bc.mutexChain.Lock()
+	if _, ok := bc.hashIndex[b.Hash()]; ok {
+		bc.mutexChain.Unlock()
+		return BLOCK_KNOWN, nil
+	}
+	tip := bc.LastBlock()
+	if b.PreviousHash() == tip.Hash() {
+		defer bc.mutexChain.Unlock()
+		if err := bc.validateBlock(bc.chain, b, bc.confirmedState()); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidBlock, err)
+		}
+		if !bc.connectBlock(b) {
+			return "", errors.New("failed to store block")
+		}
+		log.Printf("action=receive_block, from=%s, height=%d", from, b.Height())
+		go bc.broadcastBlock(b, from)
+		return BLOCK_ACCEPTED, nil
+	}
+	bc.mutexChain.Unlock()
+
+	if b.Height() <= tip.Height() {
+		return BLOCK_STALE, nil
+	}
+	go bc.syncFrom(from)
+	return BLOCK_SYNCING, nil
+}
+
+//Blockを送ってきたノード（不明なら接続中のノード）と同期し、置き換えた場合は新しい先頭のBlockを他のノードに伝えるメソッド
+func (bc *BlockChain) syncFrom(from string) {
+	peers := bc.Neighbors()
+	if from != "" {
+		peers = []string{from}
+	}
+	if bc.syncWithPeers(peers) {
+		bc.broadcastBlock(bc.Tip(), from)
+	}
+}
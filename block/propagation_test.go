@@ -0,0 +1,13 @@
+package block
+
+import "testing"
+
+//送信元が分からなくても、chainより高いBlockを受け取ったら同期を始める
+func TestReceiveBlockGapWithoutSender(t *testing.T) {
+	bc, _ := newTestBlockChain(t, LEDGER_ACCOUNT)
+	b := NewBlock(0, 5, [32]byte{1}, bc.params.NextTarget(bc.chain), nil)
+	status, err := bc.ReceiveBlock(b, "")
+	if err != nil || status != BLOCK_SYNCING {
+		t.Fatalf("status %q, err %v, want %q", status, err, BLOCK_SYNCING)
+	}
+}
@@ -0,0 +1,98 @@
+package block
+
+import (
+	"log"
+	"math/big"
+)
+
+//Blockの仕事量（条件を満たすhashを見つけるまでの試行回数の期待値 2^256/(target+1)）
+func (b *Block) Work() *big.Int {
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, new(big.Int).Add(targetToBig(b.Target()), big.NewInt(1)))
+}
+
+//chainの累積仕事量（Genesis Blockは含めない）
+func ChainWork(chain []*Block) *big.Int {
+	total := new(big.Int)
+	for i := 1; i < len(chain); i++ {
+		total.Add(total, chain[i].Work())
+	}
+	return total
+}
+
+//2つのchainで共通する最後のBlockのindex（Genesis Blockから異なる場合は-1）
+func commonAncestor(a []*Block, b []*Block) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i].Hash() == b[i].Hash() {
+		i += 1
+	}
+	return i - 1
+}
+
+//共通の祖先より後の自身のBlockをロールバックし、newChainのBlockに置き換えるメソッド
+//ロールバックしたBlockのtransactionは、newChainと競合しないものだけPoolに戻す
+func (bc *BlockChain) Reorganize(newChain []*Block) bool {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	//検証中に自身のchainが伸びている場合があるので再確認
+	if ChainWork(newChain).Cmp(ChainWork(bc.chain)) <= 0 {
+		log.Println("Error: reorg target does not have more work")
+		return false
+	}
+
+	fork := commonAncestor(bc.chain, newChain)
+	orphaned := bc.chain[fork+1:]
+	if err := bc.storeChain(newChain, fork); err != nil {
+		log.Printf("Error: store chain: %v", err)
+		return false
+	}
+	for i := len(orphaned) - 1; i >= 0; i-- {
+		bc.state.revertBlock(orphaned[i])
+		bc.unindexBlock(orphaned[i])
+	}
+	for _, b := range newChain[fork+1:] {
+		bc.state.transferBlock(b)
+		bc.indexBlock(b)
+	}
+	bc.chain = newChain
+	bc.notifyTipChanged()
+
+	//ロールバックしたtransactionをPoolの先頭に戻す（新しいchainに含まれるものは除く）
+	pool := make([]*Transaction, 0, len(bc.transactionPool))
+	returned := 0
+	for _, b := range orphaned {
+		for _, t := range b.transactions {
+			if t.IsCoinbase() || bc.state.hasTransaction(t.Hash()) {
+				continue
+			}
+			pool = append(pool, t)
+			returned += 1
+		}
+	}
+	for _, t := range bc.transactionPool {
+		if !bc.state.hasTransaction(t.Hash()) {
+			pool = append(pool, t)
+		}
+	}
+	bc.transactionPool = pool
+	//二重支払いなど競合するものは理由とともに除外
+	bc.prunePool()
+	bc.savePool()
+
+	log.Printf("action=reorg, fork=%d, rolled_back=%d, added=%d, returned=%d", fork, len(orphaned), len(newChain)-fork-1, returned)
+	return true
+}
+
+//newChainを保存するメソッド（自身のchainを伸ばすだけの場合は追加したBlockだけ書き込む）
+func (bc *BlockChain) storeChain(newChain []*Block, fork int) error {
+	if fork != len(bc.chain)-1 {
+		return bc.storage.ReplaceChain(newChain)
+	}
+	for _, b := range newChain[fork+1:] {
+		if err := bc.storage.AppendBlock(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package block
+
+import "gobc/utils"
+
+//高さheightまでのBlock（Genesis Blockを除く）で発行される量
+//半減期ごとに報酬×Block数を足し、上限からGenesis Blockの配布を除いた量で打ち切る
+func (p *Params) SupplyAt(height uint64) utils.Amount {
+	var total utils.Amount = 0
+	limit := p.MaxSupply - p.allocated
+	reward := p.InitialReward
+	remaining := height
+	for remaining > 0 && reward > 0 {
+		n := remaining
+		if p.HalvingInterval > 0 && n > p.HalvingInterval {
+			n = p.HalvingInterval
+		}
+		if reward > (limit-total)/utils.Amount(n) {
+			return limit
+		}
+		total += reward * utils.Amount(n)
+		remaining -= n
+		reward /= 2
+	}
+	return total
+}
+
+//高さheightのBlockのマイニング報酬（手数料を除く新規発行分）
+func (p *Params) RewardForHeight(height uint64) utils.Amount {
+	if height == 0 {
+		return 0
+	}
+	return p.SupplyAt(height) - p.SupplyAt(height-1)
+}
@@ -0,0 +1,369 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"gobc/utils"
+	"log"
+)
+
+//chainを先頭から適用した残高とnonceの状態
+type chainState struct {
+	balances map[string]utils.Amount
+	nonces   map[string]uint64
+	txIDs    map[[32]byte]bool
+	//未使用出力と、使用済みにした出力（ロールバック用）
+	utxos map[OutPoint]*TxOutput
+	spent map[OutPoint]*TxOutput
+	//UTXO方式の台帳か
+	utxoMode bool
+	//マイニング報酬がまだ使えない直近のBlock（nilなら全て使える）
+	immature []*Block
+	//ここにない値を参照する元の状態（nilなら空の状態）
+	//元の状態は変更せず、変更はこの状態にだけ書き込む
+	base *chainState
+}
+
+func newChainState(utxoMode bool) *chainState {
+	return &chainState{
+		balances: make(map[string]utils.Amount),
+		nonces:   make(map[string]uint64),
+		txIDs:    make(map[[32]byte]bool),
+		utxos:    make(map[OutPoint]*TxOutput),
+		spent:    make(map[OutPoint]*TxOutput),
+		utxoMode: utxoMode,
+	}
+}
+
+//baseの上に変更を重ねる状態を作成（baseはコピーしない）
+func newOverlayState(base *chainState) *chainState {
+	st := newChainState(base.utxoMode)
+	st.base = base
+	st.immature = base.immature
+	return st
+}
+
+func (st *chainState) balance(address string) utils.Amount {
+	if v, ok := st.balances[address]; ok {
+		return v
+	}
+	if st.base != nil {
+		return st.base.balance(address)
+	}
+	return 0
+}
+
+func (st *chainState) nonce(address string) uint64 {
+	if v, ok := st.nonces[address]; ok {
+		return v
+	}
+	if st.base != nil {
+		return st.base.nonce(address)
+	}
+	return 0
+}
+
+func (st *chainState) hasTransaction(id [32]byte) bool {
+	if st.txIDs[id] {
+		return true
+	}
+	return st.base != nil && st.base.hasTransaction(id)
+}
+
+//通常のtransactionを署名も含めて検証して状態に適用する
+func (st *chainState) applyTransaction(t *Transaction) error {
+	return st.checkAndApplyTransaction(t, true)
+}
+
+//Poolに入れる時に署名を確認したtransactionを、署名以外（nonce・残高・出力の使用）だけ検証して状態に適用する
+func (st *chainState) applyPooledTransaction(t *Transaction) error {
+	return st.checkAndApplyTransaction(t, false)
+}
+
+//verifySignatureがfalseの場合はECDSAの署名の検証を省く
+func (st *chainState) checkAndApplyTransaction(t *Transaction, verifySignature bool) error {
+	if t.IsUTXO() != st.utxoMode {
+		return fmt.Errorf("transaction %s: format does not match the ledger mode", t.ID())
+	}
+	if t.IsUTXO() {
+		return st.applyUTXOTransaction(t, verifySignature)
+	}
+	if st.hasTransaction(t.Hash()) {
+		return fmt.Errorf("transaction %s: duplicate", t.ID())
+	}
+	if t.value <= 0 {
+		return fmt.Errorf("transaction %s: invalid value %s", t.ID(), t.value)
+	}
+	if t.fee < 0 {
+		return fmt.Errorf("transaction %s: invalid fee %s", t.ID(), t.fee)
+	}
+	cost, err := t.value.Add(t.fee)
+	if err != nil {
+		return fmt.Errorf("transaction %s: %w", t.ID(), err)
+	}
+	if !t.IsSenderBound() {
+		return fmt.Errorf("transaction %s: sender address does not match public key", t.ID())
+	}
+	if verifySignature && !t.VerifySignature() {
+		return fmt.Errorf("transaction %s: invalid signature", t.ID())
+	}
+	if expected := st.nonce(t.senderAddress); t.nonce != expected {
+		return fmt.Errorf("transaction %s: invalid nonce %d (expected %d)", t.ID(), t.nonce, expected)
+	}
+	if balance := st.balance(t.senderAddress); balance < cost {
+		return fmt.Errorf("transaction %s: not enough balance (%s < %s)", t.ID(), balance, cost)
+	}
+	//まだ使えないマイニング報酬は残高から除く
+	immature := st.immatureAmount(t.senderAddress)
+	if spendable := st.balance(t.senderAddress) - immature; spendable < cost {
+		return fmt.Errorf("transaction %s: not enough spendable balance (%s < %s, %s immature)", t.ID(), spendable, cost, immature)
+	}
+	return st.transfer(t)
+}
+
+//マイニング報酬のtransactionを検証して状態に適用する
+//報酬は高さごとの新規発行分とBlock内の手数料の合計
+func (st *chainState) applyReward(t *Transaction, height int, subsidy utils.Amount, fees utils.Amount) error {
+	if st.hasTransaction(t.Hash()) {
+		return fmt.Errorf("reward %s: duplicate", t.ID())
+	}
+	if t.IsUTXO() != st.utxoMode {
+		return fmt.Errorf("reward %s: format does not match the ledger mode", t.ID())
+	}
+	value := t.value
+	if t.IsUTXO() {
+		if len(t.inputs) != 0 || len(t.outputs) != 1 {
+			return fmt.Errorf("reward %s: must have no inputs and one output", t.ID())
+		}
+		value = t.outputs[0].value
+	}
+	expected, err := subsidy.Add(fees)
+	if err != nil {
+		return fmt.Errorf("reward %s: %w", t.ID(), err)
+	}
+	if value != expected || t.fee != 0 {
+		return fmt.Errorf("reward %s: value %s (expected %s)", t.ID(), value, expected)
+	}
+	if t.nonce != uint64(height) {
+		return fmt.Errorf("reward %s: nonce %d (expected height %d)", t.ID(), t.nonce, height)
+	}
+	return st.transfer(t)
+}
+
+//残高を移動しnonceを進める（errorの場合chainStateは破棄する）
+func (st *chainState) transfer(t *Transaction) error {
+	if t.IsUTXO() {
+		return st.transferUTXO(t)
+	}
+	if t.senderAddress != MINING_SENDER {
+		st.balances[t.senderAddress] = st.balance(t.senderAddress) - t.value - t.fee
+		st.nonces[t.senderAddress] = st.nonce(t.senderAddress) + 1
+	}
+	received, err := st.balance(t.recipientAddress).Add(t.value)
+	if err != nil {
+		return fmt.Errorf("transaction %s: %w", t.ID(), err)
+	}
+	st.balances[t.recipientAddress] = received
+	st.txIDs[t.Hash()] = true
+	return nil
+}
+
+//transferを取り消す（baseを持たない状態にのみ使う）
+func (st *chainState) revert(t *Transaction) {
+	if t.IsUTXO() {
+		st.revertUTXO(t)
+		return
+	}
+	st.setBalance(t.recipientAddress, st.balance(t.recipientAddress)-t.value)
+	if t.senderAddress != MINING_SENDER {
+		st.setBalance(t.senderAddress, st.balance(t.senderAddress)+t.value+t.fee)
+		if n := st.nonce(t.senderAddress) - 1; n == 0 {
+			delete(st.nonces, t.senderAddress)
+		} else {
+			st.nonces[t.senderAddress] = n
+		}
+	}
+	delete(st.txIDs, t.Hash())
+}
+
+//残高を設定する（0の場合は削除して状態を比較しやすくする）
+func (st *chainState) setBalance(address string, v utils.Amount) {
+	if v == 0 {
+		delete(st.balances, address)
+		return
+	}
+	st.balances[address] = v
+}
+
+//検証済みBlockのtransactionを状態に適用する
+func (st *chainState) transferBlock(b *Block) {
+	for _, t := range b.transactions {
+		_ = st.transfer(t)
+	}
+}
+
+//transferBlockを取り消す（後ろのtransactionから戻す）
+func (st *chainState) revertBlock(b *Block) {
+	for i := len(b.transactions) - 1; i >= 0; i-- {
+		st.revert(b.transactions[i])
+	}
+}
+
+//2つの状態の残高・nonce・transactionが一致するか比較する（baseを持たない状態のみ）
+func (st *chainState) diff(other *chainState) error {
+	for address := range st.balances {
+		if st.balance(address) != other.balance(address) {
+			return fmt.Errorf("balance of %s: %s != %s", address, st.balance(address), other.balance(address))
+		}
+	}
+	for address := range other.balances {
+		if st.balance(address) != other.balance(address) {
+			return fmt.Errorf("balance of %s: %s != %s", address, st.balance(address), other.balance(address))
+		}
+	}
+	for address := range st.nonces {
+		if st.nonce(address) != other.nonce(address) {
+			return fmt.Errorf("nonce of %s: %d != %d", address, st.nonce(address), other.nonce(address))
+		}
+	}
+	for address := range other.nonces {
+		if st.nonce(address) != other.nonce(address) {
+			return fmt.Errorf("nonce of %s: %d != %d", address, st.nonce(address), other.nonce(address))
+		}
+	}
+	if len(st.utxos) != len(other.utxos) {
+		return fmt.Errorf("unspent outputs: %d != %d", len(st.utxos), len(other.utxos))
+	}
+	for op, o := range st.utxos {
+		if p := other.utxos[op]; p == nil || p.address != o.address || p.value != o.value {
+			return fmt.Errorf("unspent output %x:%d: mismatch", op.TxID, op.Index)
+		}
+	}
+	if len(st.txIDs) != len(other.txIDs) {
+		return fmt.Errorf("transactions: %d != %d", len(st.txIDs), len(other.txIDs))
+	}
+	for id := range st.txIDs {
+		if !other.txIDs[id] {
+			return fmt.Errorf("transaction %x: missing", id)
+		}
+	}
+	return nil
+}
+
+//Blockの全transactionを検証して状態に適用する
+//マイニング報酬はBlockごとにちょうど1つでなければならない
+func (st *chainState) applyBlock(b *Block, height int, subsidy utils.Amount) error {
+	fees, err := blockFees(b)
+	if err != nil {
+		return err
+	}
+	rewards := 0
+	for _, t := range b.transactions {
+		if t.IsCoinbase() {
+			rewards += 1
+			if err := st.applyReward(t, height, subsidy, fees); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := st.applyTransaction(t); err != nil {
+			return err
+		}
+	}
+	if rewards != 1 {
+		return fmt.Errorf("%d mining rewards (expected 1)", rewards)
+	}
+	return nil
+}
+
+//chain全体の状態遷移を再生して検証する
+func (bc *BlockChain) ValidateChain(chain []*Block) error {
+	if len(chain) == 0 {
+		return errors.New("empty chain")
+	}
+	//Genesis Blockはネットワークの定義から作ったものと一致しなければならない
+	if chain[0].Hash() != bc.genesisHash || chain[0].header.merkleRoot != chain[0].ComputeMerkleRoot() {
+		return fmt.Errorf("genesis block does not match network %s", bc.networkID)
+	}
+
+	st := newChainState(bc.params.IsUTXO())
+	st.transferBlock(chain[0])
+	for i := 1; i < len(chain); i++ {
+		if err := bc.validateBlock(chain[:i], chain[i], st); err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+//previousの後に続くBlockのヘッダーを検証するメソッド（previousはヘッダーだけのBlockでもよい）
+func (bc *BlockChain) validateHeader(previous []*Block, b *Block) error {
+	height := len(previous)
+	if b.Height() != uint64(height) {
+		return fmt.Errorf("invalid height %d", b.Height())
+	}
+	if b.Version() != bc.params.BlockVersion() {
+		return fmt.Errorf("invalid version %d", b.Version())
+	}
+	if err := checkMedianTimePast(b, previous); err != nil {
+		return err
+	}
+	if b.PreviousHash() != previous[height-1].Hash() {
+		return errors.New("previous hash mismatch")
+	}
+	if b.Target() != bc.params.NextTarget(previous) {
+		return fmt.Errorf("invalid target %x", b.Target())
+	}
+	if !b.header.IsValidProof() {
+		return errors.New("invalid proof of work")
+	}
+	return nil
+}
+
+//previousの後に続くBlockを検証し、stに適用するメソッド
+//stはpreviousを適用した状態でなければならない
+func (bc *BlockChain) validateBlock(previous []*Block, b *Block, st *chainState) error {
+	height := len(previous)
+	if err := bc.validateHeader(previous, b); err != nil {
+		return err
+	}
+	if len(b.transactions) > bc.params.MaxBlockTransactions {
+		return fmt.Errorf("%d transactions exceed the limit %d", len(b.transactions), bc.params.MaxBlockTransactions)
+	}
+	if size := b.Size(); size > bc.params.MaxBlockBytes {
+		return fmt.Errorf("size %d exceeds the limit %d", size, bc.params.MaxBlockBytes)
+	}
+	if b.header.merkleRoot != b.ComputeMerkleRoot() {
+		return errors.New("merkle root mismatch")
+	}
+	//Block自身の報酬も同じBlockの中ではまだ使えない
+	st.immature = immatureBlocks(append(previous[:height:height], b), height, bc.params.CoinbaseMaturity)
+	return st.applyBlock(b, height, bc.params.RewardForHeight(uint64(height)))
+}
+
+//chainを先頭から再生して状態を作る（自身のchainは検証済みなので署名の確認は省略）
+func replayState(chain []*Block, utxoMode bool) *chainState {
+	st := newChainState(utxoMode)
+	for _, b := range chain {
+		st.transferBlock(b)
+	}
+	return st
+}
+
+//保持している状態をchainから作り直した状態と比較するメソッド
+func (bc *BlockChain) CheckState() error {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	if err := bc.state.diff(replayState(bc.chain, bc.params.IsUTXO())); err != nil {
+		return fmt.Errorf("state is inconsistent with chain: %w", err)
+	}
+	return nil
+}
+
+//保持している状態をchainから作り直すメソッド
+func (bc *BlockChain) RebuildState() {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	bc.state = replayState(bc.chain, bc.params.IsUTXO())
+	log.Printf("action=rebuild_state, blocks=%d", len(bc.chain))
+}
@@ -0,0 +1,66 @@
+package block
+
+import "sync"
+
+//chainとtransactionPoolを永続化するストレージ
+type Storage interface {
+	//保存されているchainを読み込む（空の場合は長さ0）
+	LoadChain() ([]*Block, error)
+	//Blockを末尾に追記する
+	AppendBlock(b *Block) error
+	//chain全体を置き換える（ResolveConflicts用）
+	ReplaceChain(chain []*Block) error
+	//保存されているtransactionPoolを読み込む
+	LoadPool() ([]*Transaction, error)
+	//transactionPoolを保存する
+	SavePool(pool []*Transaction) error
+	Close() error
+}
+
+//メモリ上のみで保持するストレージ（再起動すると消える）
+type MemoryStorage struct {
+	chain []*Block
+	pool  []*Transaction
+	mutex sync.Mutex
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (ms *MemoryStorage) LoadChain() ([]*Block, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return append([]*Block{}, ms.chain...), nil
+}
+
+func (ms *MemoryStorage) AppendBlock(b *Block) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.chain = append(ms.chain, b)
+	return nil
+}
+
+func (ms *MemoryStorage) ReplaceChain(chain []*Block) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.chain = append([]*Block{}, chain...)
+	return nil
+}
+
+func (ms *MemoryStorage) LoadPool() ([]*Transaction, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return append([]*Transaction{}, ms.pool...), nil
+}
+
+func (ms *MemoryStorage) SavePool(pool []*Transaction) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.pool = append([]*Transaction{}, pool...)
+	return nil
+}
+
+func (ms *MemoryStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,403 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//1回のrequestで返すヘッダー数の上限
+	MAX_HEADERS_PER_PAGE = 500
+	//locatorで先頭から1つずつ並べるhashの数（以降は間隔を倍にする）
+	LOCATOR_DENSE_BLOCKS = 10
+	//1つのノードから同時にBlockの本体を取得する数
+	SYNC_DOWNLOADS_PER_PEER = 4
+	//進捗をログに出すBlock数の間隔
+	SYNC_PROGRESS_LOG_BLOCKS = 100
+	//handshakeで知った相手の高さより多く受け取るヘッダー数の上限（同期中に伸びる分）
+	SYNC_HEADERS_SLACK = MAX_HEADERS_PER_PAGE
+)
+
+//同期の進捗
+type SyncStatus struct {
+	syncing bool
+	peers   []string
+	//共通の祖先の高さと、同期先のchainの高さ
+	forkHeight   uint64
+	targetHeight uint64
+	downloaded   int
+	total        int
+	startedAt    int64
+	//最後に終わった同期の結果
+	lastResult string
+}
+
+func (s *SyncStatus) Syncing() bool {
+	return s.syncing
+}
+
+func (s *SyncStatus) MarshalJSON() ([]byte, error) {
+	progress := 1.0
+	if s.total > 0 {
+		progress = float64(s.downloaded) / float64(s.total)
+	}
+	return json.Marshal(struct {
+		Syncing      bool     `json:"syncing"`
+		Peers        []string `json:"peers"`
+		ForkHeight   uint64   `json:"fork_height"`
+		TargetHeight uint64   `json:"target_height"`
+		Downloaded   int      `json:"downloaded"`
+		Total        int      `json:"total"`
+		Progress     float64  `json:"progress"`
+		StartedAt    int64    `json:"started_at,omitempty"`
+		LastResult   string   `json:"last_result,omitempty"`
+	}{
+		Syncing:      s.syncing,
+		Peers:        s.peers,
+		ForkHeight:   s.forkHeight,
+		TargetHeight: s.targetHeight,
+		Downloaded:   s.downloaded,
+		Total:        s.total,
+		Progress:     progress,
+		StartedAt:    s.startedAt,
+		LastResult:   s.lastResult,
+	})
+}
+
+//同期の進捗を返すメソッド
+func (bc *BlockChain) SyncProgress() *SyncStatus {
+	bc.mutexSync.Lock()
+	defer bc.mutexSync.Unlock()
+	s := bc.syncStatus
+	return &s
+}
+
+func (bc *BlockChain) updateSync(update func(s *SyncStatus)) {
+	bc.mutexSync.Lock()
+	defer bc.mutexSync.Unlock()
+	update(&bc.syncStatus)
+}
+
+//自身のchainのhashを先頭から並べたlocator
+//最初のLOCATOR_DENSE_BLOCKS個は1つずつ、以降は間隔を倍にしながら遡り、最後はGenesis Blockにする
+func (bc *BlockChain) Locator() [][32]byte {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	locator := make([][32]byte, 0, LOCATOR_DENSE_BLOCKS+32)
+	step := 1
+	for h := len(bc.chain) - 1; h > 0; h -= step {
+		locator = append(locator, bc.chain[h].Hash())
+		if len(locator) >= LOCATOR_DENSE_BLOCKS {
+			step *= 2
+		}
+	}
+	return append(locator, bc.chain[0].Hash())
+}
+
+//locatorのうち最初に自身のchainにあるhashの次のBlockから、最大limit個のヘッダーを返すメソッド
+//locatorのどれもchainになければGenesis Blockから返す
+func (bc *BlockChain) HeadersAfter(locator [][32]byte, limit int) []*BlockHeader {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	if limit <= 0 || limit > MAX_HEADERS_PER_PAGE {
+		limit = MAX_HEADERS_PER_PAGE
+	}
+	var start uint64 = 0
+	for _, hash := range locator {
+		if h, ok := bc.hashIndex[hash]; ok {
+			start = h + 1
+			break
+		}
+	}
+	headers := make([]*BlockHeader, 0, limit)
+	for h := start; h < uint64(len(bc.chain)) && len(headers) < limit; h++ {
+		header := bc.chain[h].header
+		headers = append(headers, &header)
+	}
+	return headers
+}
+
+//他のノードとheaders-firstで同期するメソッド（同時に1つだけ実行する）
+//各ノードからlocatorの後のヘッダーを取得してPoWを検証し、最も仕事量の大きいchainの
+//足りないBlockの本体だけを、そのchainを持つ複数のノードから並行して取得する
+func (bc *BlockChain) syncWithPeers(peers []string) bool {
+	if !atomic.CompareAndSwapInt32(&bc.isSyncing, 0, 1) {
+		return false
+	}
+	defer atomic.StoreInt32(&bc.isSyncing, 0)
+	bc.updateSync(func(s *SyncStatus) {
+		*s = SyncStatus{syncing: true, peers: peers, startedAt: time.Now().UnixNano(), lastResult: s.lastResult}
+	})
+
+	replaced, err := bc.syncHeadersFirst(peers)
+	result := "up to date"
+	if err != nil {
+		log.Printf("Error: sync: %v", err)
+		result = err.Error()
+	} else if replaced {
+		result = "replaced"
+	}
+	bc.updateSync(func(s *SyncStatus) {
+		s.syncing = false
+		s.lastResult = result
+	})
+	return replaced
+}
+
+func (bc *BlockChain) syncHeadersFirst(peers []string) (bool, error) {
+	locator := bc.Locator()
+	bc.mutexChain.Lock()
+	bestWork := ChainWork(bc.chain)
+	bc.mutexChain.Unlock()
+
+	var best []*Block = nil
+	fork := 0
+	tips := make(map[string]*Block)
+	for _, peer := range peers {
+		headers, err := bc.fetchHeaders(peer, locator)
+		if err != nil {
+			log.Printf("Error: headers from %s: %v", peer, err)
+			bc.peers.penalize(peer, err)
+			continue
+		}
+		if len(headers) == 0 {
+			continue
+		}
+		candidate, candidateFork, err := bc.connectHeaders(headers)
+		if err != nil {
+			log.Printf("Error: headers from %s rejected: %v", peer, err)
+			bc.peers.penalize(peer, err)
+			continue
+		}
+		tips[peer] = candidate[len(candidate)-1]
+		if work := ChainWork(candidate); work.Cmp(bestWork) > 0 {
+			bestWork = work
+			best = candidate
+			fork = candidateFork
+		}
+	}
+	if best == nil {
+		return false, nil
+	}
+
+	//最も仕事量の大きいchainのBlockを持つノードから本体を取得する
+	sources := chainSources(peers, tips, best, fork)
+	bc.updateSync(func(s *SyncStatus) {
+		s.peers = sources
+		s.forkHeight = uint64(fork)
+		s.targetHeight = uint64(len(best) - 1)
+		s.total = len(best) - fork - 1
+	})
+	log.Printf("action=sync_headers, fork=%d, target=%d, peers=%s", fork, len(best)-1, strings.Join(sources, ","))
+
+	bodies, servedBy, err := bc.downloadBodies(sources, best[fork+1:])
+	if err != nil {
+		return false, err
+	}
+	newChain := append(best[:fork+1:fork+1], bodies...)
+
+	//共通の祖先までの状態から、取得したBlockだけを検証する
+	st := replayState(newChain[:fork+1], bc.params.IsUTXO())
+	for i, b := range bodies {
+		height := fork + 1 + i
+		if err := bc.validateBlock(newChain[:height], b, st); err != nil {
+			err = fmt.Errorf("%w: block %d: %v", ErrInvalidBlock, height, err)
+			bc.peers.penalize(servedBy[i], err)
+			return false, err
+		}
+	}
+	if !bc.Reorganize(newChain) {
+		return false, nil
+	}
+	return true, nil
+}
+
+//先頭のBlockがbestのfork以降に含まれるノードを返す
+//（bestより高くても仕事量の小さいchainを持つノードは含めない）
+func chainSources(peers []string, tips map[string]*Block, best []*Block, fork int) []string {
+	sources := make([]string, 0, len(tips))
+	for _, peer := range peers {
+		tip, ok := tips[peer]
+		if !ok || tip.Height() <= uint64(fork) || tip.Height() >= uint64(len(best)) {
+			continue
+		}
+		if best[tip.Height()].Hash() == tip.Hash() {
+			sources = append(sources, peer)
+		}
+	}
+	return sources
+}
+
+//取得したヘッダーを自身のchainの共通の祖先に繋げて検証し、ヘッダーだけのBlockを含むchainと共通の祖先の高さを返す
+func (bc *BlockChain) connectHeaders(headers []*Block) ([]*Block, int, error) {
+	bc.mutexChain.Lock()
+	h, ok := bc.hashIndex[headers[0].PreviousHash()]
+	if !ok {
+		bc.mutexChain.Unlock()
+		return nil, 0, fmt.Errorf("%w: no common ancestor", ErrProtocolViolation)
+	}
+	fork := int(h)
+	candidate := append(append(make([]*Block, 0, fork+1+len(headers)), bc.chain[:fork+1]...), headers...)
+	bc.mutexChain.Unlock()
+
+	if err := checkFutureTime(headers, time.Now()); err != nil {
+		return nil, 0, err
+	}
+	for i := fork + 1; i < len(candidate); i++ {
+		if err := bc.validateHeader(candidate[:i], candidate[i]); err != nil {
+			return nil, 0, fmt.Errorf("%w: header %d: %v", ErrInvalidBlock, i, err)
+		}
+	}
+	return candidate, fork, nil
+}
+
+//他のノードからlocatorの後のヘッダーを全て取得するメソッド（ヘッダーだけのBlockとして返す）
+//先にhandshakeで相手の高さを確認し、それを大きく超えるヘッダーを送ってくる場合はエラーにする
+func (bc *BlockChain) fetchHeaders(peer string, locator [][32]byte) ([]*Block, error) {
+	v, err := bc.handshake(peer)
+	if err != nil {
+		return nil, err
+	}
+	maxHeaders := v.BestHeight() + SYNC_HEADERS_SLACK
+	headers := make([]*Block, 0)
+	for {
+		hashes := make([]string, len(locator))
+		for i, hash := range locator {
+			hashes[i] = fmt.Sprintf("%x", hash)
+		}
+		endpoint := fmt.Sprintf("http://%s/headers?locator=%s&limit=%d", peer, strings.Join(hashes, ","), MAX_HEADERS_PER_PAGE)
+		res, err := peerClient().Do(bc.newPeerRequest("GET", endpoint, nil))
+		if err != nil {
+			return nil, err
+		}
+		page := &struct {
+			Headers []*BlockHeader `json:"headers"`
+		}{}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("status %d", res.StatusCode)
+		}
+		err = json.NewDecoder(res.Body).Decode(page)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrProtocolViolation, err)
+		}
+		if len(page.Headers) > MAX_HEADERS_PER_PAGE {
+			return nil, fmt.Errorf("%w: too many headers", ErrProtocolViolation)
+		}
+		if uint64(len(headers)+len(page.Headers)) > maxHeaders {
+			return nil, fmt.Errorf("%w: more than %d headers (best height %d)", ErrProtocolViolation, maxHeaders, v.BestHeight())
+		}
+		for _, h := range page.Headers {
+			if h == nil {
+				return nil, fmt.Errorf("%w: null header", ErrProtocolViolation)
+			}
+			b := &Block{header: *h}
+			b.cacheHash()
+			if len(headers) > 0 && b.PreviousHash() != headers[len(headers)-1].Hash() {
+				return nil, fmt.Errorf("%w: headers are not connected", ErrProtocolViolation)
+			}
+			headers = append(headers, b)
+		}
+		if len(page.Headers) < MAX_HEADERS_PER_PAGE {
+			return headers, nil
+		}
+		locator = [][32]byte{headers[len(headers)-1].Hash()}
+	}
+}
+
+//ヘッダーに対応するBlockの本体を複数のノードから並行して取得するメソッド（取得したノードも返す）
+//取得に失敗したBlockは次の回で別のノードに割り当て、全てのノードで失敗したらエラーにする
+func (bc *BlockChain) downloadBodies(peers []string, headers []*Block) ([]*Block, []string, error) {
+	if len(peers) == 0 {
+		return nil, nil, errors.New("no peer has the blocks")
+	}
+	bodies := make([]*Block, len(headers))
+	servedBy := make([]string, len(headers))
+	missing := make([]int, len(headers))
+	for i := range missing {
+		missing[i] = i
+	}
+	var downloaded int32 = 0
+	for round := 0; round < len(peers) && len(missing) > 0; round++ {
+		var wg sync.WaitGroup
+		for p, peer := range peers {
+			jobs := make(chan int, len(missing))
+			for _, i := range missing {
+				if (i+round)%len(peers) == p {
+					jobs <- i
+				}
+			}
+			close(jobs)
+			for w := 0; w < SYNC_DOWNLOADS_PER_PEER; w++ {
+				wg.Add(1)
+				go func(peer string, jobs <-chan int) {
+					defer wg.Done()
+					for i := range jobs {
+						b, err := bc.fetchBody(peer, headers[i])
+						if err != nil {
+							log.Printf("Error: block %d from %s: %v", headers[i].Height(), peer, err)
+							bc.peers.penalize(peer, err)
+							continue
+						}
+						bodies[i] = b
+						servedBy[i] = peer
+						n := int(atomic.AddInt32(&downloaded, 1))
+						bc.updateSync(func(s *SyncStatus) {
+							s.downloaded = n
+						})
+						if n%SYNC_PROGRESS_LOG_BLOCKS == 0 || n == len(headers) {
+							log.Printf("action=sync_progress, downloaded=%d, total=%d", n, len(headers))
+						}
+					}
+				}(peer, jobs)
+			}
+		}
+		wg.Wait()
+
+		next := make([]int, 0)
+		for _, i := range missing {
+			if bodies[i] == nil {
+				next = append(next, i)
+			}
+		}
+		missing = next
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("failed to download %d blocks", len(missing))
+	}
+	return bodies, servedBy, nil
+}
+
+//ヘッダーのhashでBlockの本体を取得し、ヘッダーとtransactionが一致するか確認するメソッド
+func (bc *BlockChain) fetchBody(peer string, header *Block) (*Block, error) {
+	endpoint := fmt.Sprintf("http://%s/blocks/hash/%x", peer, header.Hash())
+	res, err := peerClient().Do(bc.newPeerRequest("GET", endpoint, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", res.StatusCode)
+	}
+	b := new(Block)
+	if err := json.NewDecoder(res.Body).Decode(b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProtocolViolation, err)
+	}
+	if b.Hash() != header.Hash() {
+		return nil, fmt.Errorf("%w: block does not match the header", ErrProtocolViolation)
+	}
+	if b.header.merkleRoot != b.ComputeMerkleRoot() {
+		return nil, fmt.Errorf("%w: merkle root mismatch", ErrInvalidBlock)
+	}
+	return b, nil
+}
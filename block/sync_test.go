@@ -0,0 +1,131 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//nonceを変えて別のchainを作る
+func testChain(length int, nonce int) []*Block {
+	chain := make([]*Block, 0, length)
+	var previous [32]byte
+	for i := 0; i < length; i++ {
+		b := NewBlock(nonce, uint64(i), previous, [32]byte{}, nil)
+		b.cacheHash()
+		chain = append(chain, b)
+		previous = b.Hash()
+	}
+	return chain
+}
+
+//bestより高いが仕事量の小さいchainを持つノードがあってもpanicしない
+func TestChainSourcesTallerLighterPeer(t *testing.T) {
+	best := testChain(15, 1)
+	taller := append(append([]*Block{}, best[:5]...), testChain(20, 2)[5:]...)
+	tips := map[string]*Block{
+		"heavy:3000": best[len(best)-1],
+		"tall:3000":  taller[len(taller)-1],
+	}
+	sources := chainSources([]string{"tall:3000", "heavy:3000"}, tips, best, 4)
+	if len(sources) != 1 || sources[0] != "heavy:3000" {
+		t.Fatalf("sources = %v, want [heavy:3000]", sources)
+	}
+}
+
+//bestの途中までしか持たないノードも本体の取得先に含める
+func TestChainSourcesPeerBehindBest(t *testing.T) {
+	best := testChain(15, 1)
+	tips := map[string]*Block{
+		"behind:3000": best[10],
+		"forked:3000": best[3],
+	}
+	sources := chainSources([]string{"behind:3000", "forked:3000"}, tips, best, 4)
+	if len(sources) != 1 || sources[0] != "behind:3000" {
+		t.Fatalf("sources = %v, want [behind:3000]", sources)
+	}
+}
+
+//bcと同じネットワークでbestHeightの高さを名乗るノード（handshake以外のAPIはmuxに登録する）
+func newTestPeer(t *testing.T, bc *BlockChain, bestHeight uint64) (string, *http.ServeMux) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	peer := strings.TrimPrefix(server.URL, "http://")
+	mux.HandleFunc("/handshake", func(w http.ResponseWriter, req *http.Request) {
+		v := bc.LocalVersion()
+		v.bestHeight = bestHeight
+		v.listenAddress = peer
+		m, _ := v.MarshalJSON()
+		w.Write(m)
+	})
+	return peer, mux
+}
+
+//handshakeで伝えた高さを超えてヘッダーを送り続けるノードからの取得は打ち切る
+func TestFetchHeadersStopsAtPeerHeight(t *testing.T) {
+	bc, _ := newTestBlockChain(t, LEDGER_ACCOUNT)
+	var previous [32]byte
+	var height uint64 = 0
+	peer, mux := newTestPeer(t, bc, 10)
+	requests := 0
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, req *http.Request) {
+		requests += 1
+		headers := make([]*BlockHeader, 0, MAX_HEADERS_PER_PAGE)
+		for i := 0; i < MAX_HEADERS_PER_PAGE; i++ {
+			height += 1
+			b := NewBlock(0, height, previous, [32]byte{}, nil)
+			headers = append(headers, &b.header)
+			previous = b.Hash()
+		}
+		json.NewEncoder(w).Encode(struct {
+			Headers []*BlockHeader `json:"headers"`
+		}{headers})
+	})
+
+	_, err := bc.fetchHeaders(peer, bc.Locator())
+	if !errors.Is(err, ErrProtocolViolation) {
+		t.Fatalf("err = %v, want protocol violation", err)
+	}
+	if requests > 2 {
+		t.Fatalf("requested %d pages", requests)
+	}
+}
+
+//nullのヘッダーやtransactionを送ってくるノードとの同期はpanicせずエラーになる
+func TestSyncRejectsNullElements(t *testing.T) {
+	bc, _ := newTestBlockChain(t, LEDGER_UTXO)
+	peer, mux := newTestPeer(t, bc, 10)
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"headers":[null]}`))
+	})
+	header := nextTestBlock(bc, []*Transaction{bc.newReward(bc.params.RewardForHeight(1), 1)})
+	headerJSON, _ := header.header.MarshalJSON()
+	bodies := []string{
+		`{"header":` + string(headerJSON) + `,"transactions":[null]}`,
+		`{"header":` + string(headerJSON) + `,"transactions":[{"fee":"0","nonce":1,"inputs":[],"outputs":[null]}]}`,
+		`{"header":` + string(headerJSON) + `,"transactions":[{"fee":"0","nonce":1,"inputs":[null],"outputs":[{"address":"a","value":"1"}]}]}`,
+	}
+	body := ""
+	mux.HandleFunc("/blocks/hash/", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(body))
+	})
+
+	if _, err := bc.fetchHeaders(peer, bc.Locator()); !errors.Is(err, ErrProtocolViolation) {
+		t.Fatalf("null header: err = %v, want protocol violation", err)
+	}
+	if ok, _ := bc.syncHeadersFirst([]string{peer}); ok {
+		t.Fatal("synced from a peer sending a null header")
+	}
+	for _, body = range bodies {
+		if _, err := bc.fetchBody(peer, header); !errors.Is(err, ErrProtocolViolation) {
+			t.Fatalf("body %s: err = %v, want protocol violation", body, err)
+		}
+		if _, _, err := bc.downloadBodies([]string{peer}, []*Block{header}); err == nil {
+			t.Fatalf("body %s was downloaded", body)
+		}
+	}
+}
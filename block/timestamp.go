@@ -0,0 +1,52 @@
+package block
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	//median-time-pastを求める直近のBlock数
+	MEDIAN_TIME_SPAN = 11
+	//他のノードから受け取るBlockのtimestampが自身の時計より進んでいてよい上限
+	MAX_FUTURE_BLOCK_TIME_SEC = 2 * 60
+)
+
+//chainの末尾MEDIAN_TIME_SPAN個のBlockのtimestampの中央値
+func MedianTimePast(chain []*Block) int64 {
+	if len(chain) == 0 {
+		return 0
+	}
+	start := len(chain) - MEDIAN_TIME_SPAN
+	if start < 0 {
+		start = 0
+	}
+	times := make([]int64, 0, MEDIAN_TIME_SPAN)
+	for _, b := range chain[start:] {
+		times = append(times, b.Timestamp())
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i] < times[j]
+	})
+	return times[len(times)/2]
+}
+
+//Blockのtimestampが前のBlockのmedian-time-pastより後か判定する
+func checkMedianTimePast(b *Block, previous []*Block) error {
+	if mtp := MedianTimePast(previous); b.Timestamp() <= mtp {
+		return fmt.Errorf("timestamp %d is not after median time past %d", b.Timestamp(), mtp)
+	}
+	return nil
+}
+
+//chainにnowより未来すぎるtimestampのBlockがないか判定する
+func checkFutureTime(chain []*Block, now time.Time) error {
+	limit := now.Add(MAX_FUTURE_BLOCK_TIME_SEC * time.Second).UnixNano()
+	for _, b := range chain {
+		if b.Timestamp() > limit {
+			return fmt.Errorf("block %d: timestamp %d is too far in the future", b.Height(), b.Timestamp())
+		}
+	}
+	return nil
+}
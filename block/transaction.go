@@ -1,8 +1,12 @@
 package block
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gobc/utils"
 	"strings"
 )
 
@@ -10,41 +14,246 @@ import (
 type Transaction struct {
 	senderAddress    string
 	recipientAddress string
-	value            float32
+	value            utils.Amount
+	fee              utils.Amount //マイナーに支払う手数料
+	nonce            uint64       //senderごとの連番（マイニング報酬はBlockの高さ）
+	senderPublicKey  *ecdsa.PublicKey
+	signature        *utils.Signature
+	//UTXO方式の入力と出力（アカウント方式では空）
+	inputs  []*TxInput
+	outputs []*TxOutput
 }
 
 //適切にJSONMarshalするメソッドオーバーライド（json.Marshalの上書き）小文字のメンバはmarshalできないがjsonでは小文字で扱いたい
 func (t *Transaction) MarshalJSON() ([]byte, error) {
+	if t.IsUTXO() {
+		inputs := t.inputs
+		if inputs == nil {
+			inputs = []*TxInput{}
+		}
+		return json.Marshal(struct {
+			ID            string       `json:"id"`
+			SenderAddress string       `json:"sender_address,omitempty"`
+			Fee           utils.Amount `json:"fee"`
+			Nonce         uint64       `json:"nonce"`
+			Inputs        []*TxInput   `json:"inputs"`
+			Outputs       []*TxOutput  `json:"outputs"`
+		}{
+			ID:            t.ID(),
+			SenderAddress: t.senderAddress,
+			Fee:           t.fee,
+			Nonce:         t.nonce,
+			Inputs:        inputs,
+			Outputs:       t.outputs,
+		})
+	}
 	return json.Marshal(struct {
-		SenderAddress    string  `json:"sender_address"`
-		RecipientAddress string  `json:"recipient_address"`
-		Value            float32 `json:"value"`
+		ID               string       `json:"id"`
+		SenderAddress    string       `json:"sender_address"`
+		RecipientAddress string       `json:"recipient_address"`
+		Value            utils.Amount `json:"value"`
+		Fee              utils.Amount `json:"fee"`
+		Nonce            uint64       `json:"nonce"`
+		SenderPublicKey  string       `json:"sender_public_key,omitempty"`
+		Signature        string       `json:"signature,omitempty"`
+	}{
+		ID:               t.ID(),
+		SenderAddress:    t.senderAddress,
+		RecipientAddress: t.recipientAddress,
+		Value:            t.value,
+		Fee:              t.fee,
+		Nonce:            t.nonce,
+		SenderPublicKey:  t.SenderPublicKeyStr(),
+		Signature:        t.SignatureStr(),
+	})
+}
+
+//署名とIDの対象となるJSON（wallet.TransactionのMarshalJSONと同じ形式）
+//手数料が0の場合は含めない（手数料導入前のtransactionと同じIDになる）
+func (t *Transaction) signedMessage() []byte {
+	if t.IsUTXO() {
+		return t.utxoSignedMessage()
+	}
+	m, _ := json.Marshal(struct {
+		SenderAddress    string       `json:"sender_address"`
+		RecipientAddress string       `json:"recipient_address"`
+		Value            utils.Amount `json:"value"`
+		Fee              utils.Amount `json:"fee,omitempty"`
+		Nonce            uint64       `json:"nonce"`
 	}{
 		SenderAddress:    t.senderAddress,
 		RecipientAddress: t.recipientAddress,
 		Value:            t.value,
+		Fee:              t.fee,
+		Nonce:            t.nonce,
 	})
+	return m
+}
+
+//TransactionのHash（署名対象）
+func (t *Transaction) Hash() [32]byte {
+	return sha256.Sum256(t.signedMessage())
+}
+
+//TransactionのID（Hashの16進文字列）
+func (t *Transaction) ID() string {
+	return fmt.Sprintf("%x", t.Hash())
+}
+
+func (t *Transaction) SenderAddress() string {
+	return t.senderAddress
+}
+
+func (t *Transaction) RecipientAddress() string {
+	return t.recipientAddress
+}
+
+func (t *Transaction) Value() utils.Amount {
+	return t.value
+}
+
+func (t *Transaction) Fee() utils.Amount {
+	return t.fee
+}
+
+//JSONでのサイズ（手数料率の計算に使う）
+func (t *Transaction) Size() int {
+	m, _ := t.MarshalJSON()
+	return len(m)
+}
+
+//1byteあたりの手数料（最小単位）
+func (t *Transaction) FeeRate() float64 {
+	return float64(t.fee) / float64(t.Size())
+}
+
+func (t *Transaction) Nonce() uint64 {
+	return t.nonce
+}
+
+func (t *Transaction) SenderPublicKey() *ecdsa.PublicKey {
+	return t.senderPublicKey
+}
+
+//publicKeyの文字列（マイニング報酬の場合は空）
+func (t *Transaction) SenderPublicKeyStr() string {
+	if t.senderPublicKey == nil {
+		return ""
+	}
+	return utils.PublicKeyToString(t.senderPublicKey)
+}
+
+func (t *Transaction) Signature() *utils.Signature {
+	return t.signature
+}
+
+//Signatureの文字列（マイニング報酬の場合は空）
+func (t *Transaction) SignatureStr() string {
+	if t.signature == nil {
+		return ""
+	}
+	return t.signature.String()
+}
+
+//保持しているSignatureをsenderPublicKeyで認証するメソッド
+func (t *Transaction) VerifySignature() bool {
+	if t.senderPublicKey == nil || t.signature == nil {
+		return false
+	}
+	h := t.Hash()
+	return ecdsa.Verify(t.senderPublicKey, h[:], t.signature.R, t.signature.S)
+}
+
+//senderAddressがsenderPublicKeyから生成されたものか判定するメソッド
+func (t *Transaction) IsSenderBound() bool {
+	return utils.IsAddressOf(t.senderAddress, t.senderPublicKey)
+}
+
+//状態を見ずに確認できる署名が正しいか判定するメソッド
+//アカウント方式はsenderAddressと鍵の対応も、UTXO方式は全ての入力の署名を確認する
+func (t *Transaction) HasValidSignatures() bool {
+	if !t.IsUTXO() {
+		return t.IsSenderBound() && t.VerifySignature()
+	}
+	h := t.Hash()
+	for _, in := range t.inputs {
+		if in.publicKey == nil || in.signature == nil || !ecdsa.Verify(in.publicKey, h[:], in.signature.R, in.signature.S) {
+			return false
+		}
+	}
+	return true
 }
 
 func (t *Transaction) UnmarshalJSON(data []byte) error {
+	var pubKey, sign string
 	v := &struct {
-		SenderAddress    *string  `json:"sender_address"`
-		RecipientAddress *string  `json:"recipient_address"`
-		Value            *float32 `json:"value"`
+		SenderAddress    *string       `json:"sender_address"`
+		RecipientAddress *string       `json:"recipient_address"`
+		Value            *utils.Amount `json:"value"`
+		Fee              *utils.Amount `json:"fee"`
+		Nonce            *uint64       `json:"nonce"`
+		SenderPublicKey  *string       `json:"sender_public_key"`
+		Signature        *string       `json:"signature"`
+		Inputs           *[]*TxInput   `json:"inputs"`
+		Outputs          *[]*TxOutput  `json:"outputs"`
 	}{
+		Inputs:           &t.inputs,
+		Outputs:          &t.outputs,
 		SenderAddress:    &t.senderAddress,
 		RecipientAddress: &t.recipientAddress,
 		Value:            &t.value,
+		Fee:              &t.fee,
+		Nonce:            &t.nonce,
+		SenderPublicKey:  &pubKey,
+		Signature:        &sign,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
+	if hasNullInOut(t.inputs, t.outputs) {
+		return errors.New("null input or output")
+	}
+	//UTXO方式ではhashに含まれないアカウント方式の項目を持たせない（Blockのhashを変えずに書き換えられるため）
+	if t.IsUTXO() {
+		if t.recipientAddress != "" || t.value != 0 || pubKey != "" || sign != "" {
+			return errors.New("UTXO transaction has account fields")
+		}
+		if len(t.inputs) > 0 && t.senderAddress != "" {
+			return errors.New("UTXO transaction has sender_address")
+		}
+		if len(t.inputs) == 0 {
+			if t.senderAddress != "" && t.senderAddress != MINING_SENDER {
+				return fmt.Errorf("coinbase has sender_address %q", t.senderAddress)
+			}
+			t.senderAddress = MINING_SENDER
+		}
+	}
+	if pubKey != "" {
+		if len(pubKey) != 128 {
+			return errors.New("invalid sender_public_key")
+		}
+		t.senderPublicKey = utils.StringToPublicKey(pubKey)
+	}
+	if sign != "" {
+		if len(sign) != 128 {
+			return errors.New("invalid signature")
+		}
+		t.signature = utils.StringToSignature(sign)
+	}
 	return nil
 }
 
 //Transactionを作成するメソッド
-func NewTransaction(sender string, recipient string, value float32) *Transaction {
-	return &Transaction{sender, recipient, value}
+func NewTransaction(sender string, recipient string, value utils.Amount, fee utils.Amount, nonce uint64, senderPubKey *ecdsa.PublicKey, s *utils.Signature) *Transaction {
+	return &Transaction{
+		senderAddress:    sender,
+		recipientAddress: recipient,
+		value:            value,
+		fee:              fee,
+		nonce:            nonce,
+		senderPublicKey:  senderPubKey,
+		signature:        s,
+	}
 }
 
 //Transaction情報のプリント用メソッド
@@ -52,26 +261,61 @@ func (t *Transaction) Print() {
 	fmt.Printf("%s Transaction %s\n", strings.Repeat("-", 6), strings.Repeat("-", 6))
 	fmt.Printf("senderAdress     : %s\n", t.senderAddress)
 	fmt.Printf("recipientAdress  : %s\n", t.recipientAddress)
-	fmt.Printf("value            : %.2f\n", t.value)
+	fmt.Printf("id               : %s\n", t.ID())
+	fmt.Printf("value            : %s\n", t.value)
+	fmt.Printf("fee              : %s\n", t.fee)
+	fmt.Printf("nonce            : %d\n", t.nonce)
+	for _, in := range t.inputs {
+		fmt.Printf("input            : %x:%d\n", in.outPoint.TxID, in.outPoint.Index)
+	}
+	for _, o := range t.outputs {
+		fmt.Printf("output           : %s %s\n", o.address, o.value)
+	}
 	fmt.Println(strings.Repeat("-", 25))
 }
 
 //requestの情報
 type TransactionRequest struct {
-	SenderPublicKey  *string  `json:"sender_public_key"`
-	SenderAddress    *string  `json:"sender_address"`
-	RecipientAddress *string  `json:"recipient_address"`
-	Value            *float32 `json:"value"`
-	Signature        *string  `json:"signature"`
+	SenderPublicKey  *string       `json:"sender_public_key"`
+	SenderAddress    *string       `json:"sender_address"`
+	RecipientAddress *string       `json:"recipient_address"`
+	Value            *utils.Amount `json:"value"`
+	Fee              *utils.Amount `json:"fee"` //省略した場合は0
+	Nonce            *uint64       `json:"nonce"`
+	Signature        *string       `json:"signature"`
+	//UTXO方式の場合は上記の代わりにinputsとoutputsを指定する
+	Inputs  []*TxInput  `json:"inputs"`
+	Outputs []*TxOutput `json:"outputs"`
+}
+
+//UTXO方式のrequestか判定するメソッド
+func (req *TransactionRequest) IsUTXO() bool {
+	return req.Inputs != nil || req.Outputs != nil
+}
+
+//手数料（省略した場合は0）
+func (req *TransactionRequest) FeeOrZero() utils.Amount {
+	if req.Fee == nil {
+		return 0
+	}
+	return *req.Fee
 }
 
 //requestのValidate
 func (req *TransactionRequest) Validate() bool {
-	if *req.SenderPublicKey == "" ||
-		*req.SenderAddress == "" ||
-		*req.RecipientAddress == "" ||
-		*req.Signature == "" ||
-		req.Value == nil {
+	if req.Fee != nil && *req.Fee < 0 {
+		return false
+	}
+	if req.IsUTXO() {
+		return len(req.Inputs) > 0 && len(req.Outputs) > 0 && !hasNullInOut(req.Inputs, req.Outputs)
+	}
+	if req.SenderPublicKey == nil || len(*req.SenderPublicKey) != 128 ||
+		req.SenderAddress == nil || *req.SenderAddress == "" ||
+		req.RecipientAddress == nil || *req.RecipientAddress == "" ||
+		req.Signature == nil || len(*req.Signature) != 128 ||
+		req.Value == nil ||
+		*req.Value <= 0 ||
+		req.Nonce == nil {
 		return false
 	}
 	return true
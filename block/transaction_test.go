@@ -0,0 +1,77 @@
+package block
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+//UTXO方式のマイニング報酬は入力がないことで判定し、sender_addressの有無でhashも判定も変わらない
+func TestUTXOCoinbaseIgnoresSenderAddress(t *testing.T) {
+	coinbase := NewCoinbase("miner", 100, 1)
+	m, _ := json.Marshal(coinbase)
+	stripped := strings.Replace(string(m), `"sender_address":"NETWORK",`, "", 1)
+	if stripped == string(m) {
+		t.Fatalf("sender_address not found in %s", m)
+	}
+
+	decoded := new(Transaction)
+	if err := json.Unmarshal([]byte(stripped), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.IsCoinbase() || decoded.Hash() != coinbase.Hash() || decoded.SenderAddress() != MINING_SENDER {
+		t.Fatalf("decoded coinbase = %s", stripped)
+	}
+}
+
+//入力のあるUTXO方式のtransactionにsender_addressを付けたものは拒否する
+func TestUTXOTransactionRejectsSenderAddress(t *testing.T) {
+	coinbase := NewCoinbase("miner", 100, 1)
+	spend := NewUTXOTransaction(
+		[]*TxInput{NewTxInput(OutPoint{TxID: coinbase.Hash(), Index: 0}, nil, nil)},
+		[]*TxOutput{NewTxOutput("someone", 100)},
+		0,
+	)
+	m := `{"sender_address":"NETWORK","fee":0,"nonce":0,"inputs":[{"tx_id":"` + coinbase.ID() + `","index":0,` +
+		`"public_key":"` + strings.Repeat("1", 128) + `","signature":"` + strings.Repeat("1", 128) + `"}],` +
+		`"outputs":[{"address":"someone","value":"100"}]}`
+	if err := json.Unmarshal([]byte(m), new(Transaction)); err == nil {
+		t.Fatal("UTXO transaction with sender_address was accepted")
+	}
+	if err := json.Unmarshal([]byte(strings.Replace(m, `"sender_address":"NETWORK",`, "", 1)), new(Transaction)); err != nil {
+		t.Fatalf("UTXO transaction without sender_address: %v", err)
+	}
+	if spend.IsCoinbase() {
+		t.Fatal("transaction with inputs is a coinbase")
+	}
+}
+
+//nullの入力・出力を含むUTXO方式のtransactionとrequestは拒否する
+func TestUTXONullInputsAndOutputs(t *testing.T) {
+	output := `{"address":"someone","value":"1"}`
+	input := `{"tx_id":"` + strings.Repeat("0", 64) + `","index":0,"public_key":"` + strings.Repeat("1", 128) +
+		`","signature":"` + strings.Repeat("1", 128) + `"}`
+	cases := map[string]string{
+		"null input":  `{"inputs":[null],"outputs":[` + output + `]}`,
+		"null output": `{"inputs":[` + input + `],"outputs":[null]}`,
+		"mixed":       `{"inputs":[` + input + `,null],"outputs":[` + output + `,null]}`,
+	}
+	for name, m := range cases {
+		if err := json.Unmarshal([]byte(m), new(Transaction)); err == nil {
+			t.Errorf("%s: transaction was accepted", name)
+		}
+		req := new(TransactionRequest)
+		if err := json.Unmarshal([]byte(m), req); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if req.Validate() {
+			t.Errorf("%s: request was accepted", name)
+		}
+	}
+
+	valid := `{"inputs":[` + input + `],"outputs":[` + output + `]}`
+	req := new(TransactionRequest)
+	if err := json.Unmarshal([]byte(valid), req); err != nil || !req.Validate() {
+		t.Fatalf("valid request rejected: %v", err)
+	}
+}
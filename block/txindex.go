@@ -0,0 +1,165 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"gobc/utils"
+)
+
+//1回のrequestで返すtransaction数の上限
+const MAX_TRANSACTIONS_PER_PAGE = 100
+
+//transactionが含まれるBlockの高さとBlock内の位置
+type txLocation struct {
+	height uint64
+	index  int
+}
+
+//transactionと、Blockに含まれているか（未承認か）の状態
+type TransactionStatus struct {
+	transaction *Transaction
+	pending     bool
+	blockHeight uint64
+	blockHash   [32]byte
+	//含まれるBlockを1として数えた、その後に積まれたBlock数
+	confirmations uint64
+}
+
+func (s *TransactionStatus) Transaction() *Transaction {
+	return s.transaction
+}
+
+func (s *TransactionStatus) Pending() bool {
+	return s.pending
+}
+
+func (s *TransactionStatus) MarshalJSON() ([]byte, error) {
+	status := "confirmed"
+	var height *uint64
+	blockHash := ""
+	if s.pending {
+		status = "pending"
+	} else {
+		height = &s.blockHeight
+		blockHash = fmt.Sprintf("%x", s.blockHash)
+	}
+	return json.Marshal(struct {
+		Status        string       `json:"status"`
+		BlockHeight   *uint64      `json:"block_height,omitempty"`
+		BlockHash     string       `json:"block_hash,omitempty"`
+		Confirmations uint64       `json:"confirmations"`
+		Transaction   *Transaction `json:"transaction"`
+	}{
+		Status:        status,
+		BlockHeight:   height,
+		BlockHash:     blockHash,
+		Confirmations: s.confirmations,
+		Transaction:   s.transaction,
+	})
+}
+
+//transactionの送信者と受信者（マイニング報酬の送信者は除く）
+//UTXO方式の場合は入力の鍵のaddressと出力のaddress
+func transactionAddresses(t *Transaction) []string {
+	candidates := []string{t.senderAddress, t.recipientAddress}
+	for _, in := range t.inputs {
+		candidates = append(candidates, utils.PublicKeyToAddress(in.publicKey))
+	}
+	for _, o := range t.outputs {
+		candidates = append(candidates, o.address)
+	}
+	addresses := make([]string, 0, 2)
+	seen := make(map[string]bool)
+	for _, address := range candidates {
+		if address == "" || address == MINING_SENDER || seen[address] {
+			continue
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+//Blockのtransactionをindexに登録するメソッド
+func (bc *BlockChain) indexTransactions(b *Block) {
+	for i, t := range b.transactions {
+		loc := txLocation{height: b.Height(), index: i}
+		bc.txIndex[t.Hash()] = loc
+		for _, address := range transactionAddresses(t) {
+			bc.addressIndex[address] = append(bc.addressIndex[address], loc)
+		}
+	}
+}
+
+//Blockのtransactionをindexから削除するメソッド
+//Blockはchainの末尾から外されるので、addressごとの一覧も末尾から削る
+func (bc *BlockChain) unindexTransactions(b *Block) {
+	for _, t := range b.transactions {
+		delete(bc.txIndex, t.Hash())
+		for _, address := range transactionAddresses(t) {
+			locs := bc.addressIndex[address]
+			n := len(locs)
+			for n > 0 && locs[n-1].height >= b.Height() {
+				n -= 1
+			}
+			if n == 0 {
+				delete(bc.addressIndex, address)
+			} else {
+				bc.addressIndex[address] = locs[:n]
+			}
+		}
+	}
+}
+
+//indexの位置から承認済みの状態を作るメソッド
+func (bc *BlockChain) confirmedStatus(loc txLocation) *TransactionStatus {
+	b := bc.chain[loc.height]
+	return &TransactionStatus{
+		transaction:   b.transactions[loc.index],
+		blockHeight:   loc.height,
+		blockHash:     b.Hash(),
+		confirmations: uint64(len(bc.chain)) - loc.height,
+	}
+}
+
+//IDからtransactionを探すメソッド（chainになければPoolを探し、どちらにもなければnil）
+func (bc *BlockChain) TransactionByID(id [32]byte) *TransactionStatus {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	if loc, ok := bc.txIndex[id]; ok {
+		return bc.confirmedStatus(loc)
+	}
+	for _, t := range bc.transactionPool {
+		if t.Hash() == id {
+			return &TransactionStatus{transaction: t, pending: true}
+		}
+	}
+	return nil
+}
+
+//addressに関係する承認済みのtransactionを新しい順に返すメソッド
+//cursorより前（古い）ものから最大limit個返し、続きがあれば次のcursor、なければ-1を返す
+//cursorが負の場合は最新のものから返す
+func (bc *BlockChain) AddressTransactions(address string, cursor int, limit int) ([]*TransactionStatus, int) {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	if limit <= 0 || limit > MAX_TRANSACTIONS_PER_PAGE {
+		limit = MAX_TRANSACTIONS_PER_PAGE
+	}
+	locs := bc.addressIndex[address]
+	if cursor < 0 || cursor > len(locs) {
+		cursor = len(locs)
+	}
+	statuses := make([]*TransactionStatus, 0, limit)
+	i := cursor
+	for i > 0 && len(statuses) < limit {
+		i -= 1
+		statuses = append(statuses, bc.confirmedStatus(locs[i]))
+	}
+	if i == 0 {
+		return statuses, -1
+	}
+	return statuses, i
+}
@@ -0,0 +1,406 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gobc/utils"
+	"log"
+)
+
+//transactionの出力の位置（transactionのIDと出力の番号）
+type OutPoint struct {
+	TxID  [32]byte
+	Index uint32
+}
+
+func (op OutPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TxID  string `json:"tx_id"`
+		Index uint32 `json:"index"`
+	}{
+		TxID:  fmt.Sprintf("%x", op.TxID),
+		Index: op.Index,
+	})
+}
+
+func (op *OutPoint) UnmarshalJSON(data []byte) error {
+	var v struct {
+		TxID  *string `json:"tx_id"`
+		Index *uint32 `json:"index"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.TxID == nil || v.Index == nil {
+		return errors.New("missing tx_id or index")
+	}
+	op.Index = *v.Index
+	return decodeHash(*v.TxID, &op.TxID)
+}
+
+//transactionの出力（addressにvalueを送る）
+type TxOutput struct {
+	address string
+	value   utils.Amount
+}
+
+func NewTxOutput(address string, value utils.Amount) *TxOutput {
+	return &TxOutput{address: address, value: value}
+}
+
+func (o *TxOutput) Address() string {
+	return o.address
+}
+
+func (o *TxOutput) Value() utils.Amount {
+	return o.value
+}
+
+func (o *TxOutput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address string       `json:"address"`
+		Value   utils.Amount `json:"value"`
+	}{
+		Address: o.address,
+		Value:   o.value,
+	})
+}
+
+func (o *TxOutput) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		Address *string       `json:"address"`
+		Value   *utils.Amount `json:"value"`
+	}{
+		Address: &o.address,
+		Value:   &o.value,
+	}
+	return json.Unmarshal(data, v)
+}
+
+//transactionの入力（使用する出力と、その出力のaddressの鍵による署名）
+type TxInput struct {
+	outPoint  OutPoint
+	publicKey *ecdsa.PublicKey
+	signature *utils.Signature
+}
+
+func NewTxInput(outPoint OutPoint, publicKey *ecdsa.PublicKey, s *utils.Signature) *TxInput {
+	return &TxInput{outPoint: outPoint, publicKey: publicKey, signature: s}
+}
+
+func (in *TxInput) OutPoint() OutPoint {
+	return in.outPoint
+}
+
+func (in *TxInput) PublicKey() *ecdsa.PublicKey {
+	return in.publicKey
+}
+
+func (in *TxInput) Signature() *utils.Signature {
+	return in.signature
+}
+
+func (in *TxInput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TxID      string `json:"tx_id"`
+		Index     uint32 `json:"index"`
+		PublicKey string `json:"public_key"`
+		Signature string `json:"signature"`
+	}{
+		TxID:      fmt.Sprintf("%x", in.outPoint.TxID),
+		Index:     in.outPoint.Index,
+		PublicKey: utils.PublicKeyToString(in.publicKey),
+		Signature: in.signature.String(),
+	})
+}
+
+func (in *TxInput) UnmarshalJSON(data []byte) error {
+	var v struct {
+		PublicKey string `json:"public_key"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &in.outPoint); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if len(v.PublicKey) != 128 {
+		return errors.New("invalid public_key")
+	}
+	if len(v.Signature) != 128 {
+		return errors.New("invalid signature")
+	}
+	in.publicKey = utils.StringToPublicKey(v.PublicKey)
+	in.signature = utils.StringToSignature(v.Signature)
+	return nil
+}
+
+//UTXO方式のtransactionを作成
+func NewUTXOTransaction(inputs []*TxInput, outputs []*TxOutput, fee utils.Amount) *Transaction {
+	return &Transaction{inputs: inputs, outputs: outputs, fee: fee}
+}
+
+//UTXO方式のマイニング報酬（nonceにはBlockの高さを入れてIDが重複しないようにする）
+func NewCoinbase(recipient string, value utils.Amount, height uint64) *Transaction {
+	return &Transaction{
+		senderAddress: MINING_SENDER,
+		nonce:         height,
+		outputs:       []*TxOutput{NewTxOutput(recipient, value)},
+	}
+}
+
+//UTXO方式のtransactionか判定するメソッド
+func (t *Transaction) IsUTXO() bool {
+	return len(t.outputs) > 0
+}
+
+//マイニング報酬（Genesis Blockの配布を含む）か判定するメソッド
+//UTXO方式のsenderAddressはhashに含まれないので、入力がないことで判定する
+func (t *Transaction) IsCoinbase() bool {
+	if t.IsUTXO() {
+		return len(t.inputs) == 0
+	}
+	return t.senderAddress == MINING_SENDER
+}
+
+func (t *Transaction) Inputs() []*TxInput {
+	return t.inputs
+}
+
+func (t *Transaction) Outputs() []*TxOutput {
+	return t.outputs
+}
+
+//JSONのnullから作られた空の入力・出力があるか判定する
+func hasNullInOut(inputs []*TxInput, outputs []*TxOutput) bool {
+	for _, in := range inputs {
+		if in == nil {
+			return true
+		}
+	}
+	for _, o := range outputs {
+		if o == nil {
+			return true
+		}
+	}
+	return false
+}
+
+//UTXO方式の署名とIDの対象となるJSON（wallet.UTXOTransactionのMarshalJSONと同じ形式）
+func (t *Transaction) utxoSignedMessage() []byte {
+	outPoints := make([]OutPoint, len(t.inputs))
+	for i, in := range t.inputs {
+		outPoints[i] = in.outPoint
+	}
+	m, _ := json.Marshal(struct {
+		Inputs  []OutPoint   `json:"inputs"`
+		Outputs []*TxOutput  `json:"outputs"`
+		Fee     utils.Amount `json:"fee,omitempty"`
+		Nonce   uint64       `json:"nonce"`
+	}{
+		Inputs:  outPoints,
+		Outputs: t.outputs,
+		Fee:     t.fee,
+		Nonce:   t.nonce,
+	})
+	return m
+}
+
+//出力の合計
+func (t *Transaction) OutputValue() (utils.Amount, error) {
+	var total utils.Amount = 0
+	for _, o := range t.outputs {
+		var err error
+		if total, err = total.Add(o.value); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+//未使用出力とその位置
+type UTXO struct {
+	OutPoint OutPoint
+	Output   *TxOutput
+}
+
+func (u *UTXO) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TxID    string       `json:"tx_id"`
+		Index   uint32       `json:"index"`
+		Address string       `json:"address"`
+		Value   utils.Amount `json:"value"`
+	}{
+		TxID:    fmt.Sprintf("%x", u.OutPoint.TxID),
+		Index:   u.OutPoint.Index,
+		Address: u.Output.address,
+		Value:   u.Output.value,
+	})
+}
+
+//未使用出力を返す（使用済みまたは存在しなければnil）
+func (st *chainState) utxo(op OutPoint) *TxOutput {
+	if _, ok := st.spent[op]; ok {
+		return nil
+	}
+	if o, ok := st.utxos[op]; ok {
+		return o
+	}
+	if st.base != nil {
+		return st.base.utxo(op)
+	}
+	return nil
+}
+
+//addressの未使用出力の一覧
+func (st *chainState) unspentOutputs(address string) []*UTXO {
+	var utxos []*UTXO
+	if st.base != nil {
+		for _, u := range st.base.unspentOutputs(address) {
+			if _, ok := st.spent[u.OutPoint]; !ok {
+				utxos = append(utxos, u)
+			}
+		}
+	}
+	for op, o := range st.utxos {
+		if o.address == address {
+			utxos = append(utxos, &UTXO{OutPoint: op, Output: o})
+		}
+	}
+	return utxos
+}
+
+//UTXO方式のtransactionを検証して状態に適用する
+//各入力は未使用出力を参照し、その出力のaddressの鍵で署名されていなければならない
+func (st *chainState) applyUTXOTransaction(t *Transaction, verifySignature bool) error {
+	if st.hasTransaction(t.Hash()) {
+		return fmt.Errorf("transaction %s: duplicate", t.ID())
+	}
+	if len(t.inputs) == 0 {
+		return fmt.Errorf("transaction %s: no inputs", t.ID())
+	}
+	if t.fee < 0 {
+		return fmt.Errorf("transaction %s: invalid fee %s", t.ID(), t.fee)
+	}
+	for _, o := range t.outputs {
+		if o.value <= 0 || o.address == "" {
+			return fmt.Errorf("transaction %s: invalid output", t.ID())
+		}
+	}
+	outputValue, err := t.OutputValue()
+	if err != nil {
+		return fmt.Errorf("transaction %s: %w", t.ID(), err)
+	}
+
+	h := t.Hash()
+	used := make(map[OutPoint]bool)
+	var inputValue utils.Amount = 0
+	for i, in := range t.inputs {
+		if used[in.outPoint] {
+			return fmt.Errorf("transaction %s: input %d spends the same output twice", t.ID(), i)
+		}
+		used[in.outPoint] = true
+		prev := st.utxo(in.outPoint)
+		if prev == nil {
+			return fmt.Errorf("transaction %s: input %d: output %x:%d is spent or does not exist", t.ID(), i, in.outPoint.TxID, in.outPoint.Index)
+		}
+		if st.isImmatureOutput(in.outPoint) {
+			return fmt.Errorf("transaction %s: input %d: reward output %x:%d is not mature", t.ID(), i, in.outPoint.TxID, in.outPoint.Index)
+		}
+		if !utils.IsAddressOf(prev.address, in.publicKey) {
+			return fmt.Errorf("transaction %s: input %d: public key does not match %s", t.ID(), i, prev.address)
+		}
+		if verifySignature && (in.signature == nil || !ecdsa.Verify(in.publicKey, h[:], in.signature.R, in.signature.S)) {
+			return fmt.Errorf("transaction %s: input %d: invalid signature", t.ID(), i)
+		}
+		if inputValue, err = inputValue.Add(prev.value); err != nil {
+			return fmt.Errorf("transaction %s: %w", t.ID(), err)
+		}
+	}
+	//入力と出力の差額が手数料
+	if spent, err := outputValue.Add(t.fee); err != nil || inputValue != spent {
+		return fmt.Errorf("transaction %s: inputs %s do not match outputs %s plus fee %s", t.ID(), inputValue, outputValue, t.fee)
+	}
+	return st.transferUTXO(t)
+}
+
+//入力の出力を使用済みにし、新しい出力を追加する（errorの場合chainStateは破棄する）
+func (st *chainState) transferUTXO(t *Transaction) error {
+	for _, in := range t.inputs {
+		prev := st.utxo(in.outPoint)
+		if prev == nil {
+			return fmt.Errorf("transaction %s: output %x:%d is spent or does not exist", t.ID(), in.outPoint.TxID, in.outPoint.Index)
+		}
+		st.spent[in.outPoint] = prev
+		delete(st.utxos, in.outPoint)
+		st.setBalance(prev.address, st.balance(prev.address)-prev.value)
+	}
+	id := t.Hash()
+	for i, o := range t.outputs {
+		st.utxos[OutPoint{TxID: id, Index: uint32(i)}] = o
+		received, err := st.balance(o.address).Add(o.value)
+		if err != nil {
+			return fmt.Errorf("transaction %s: %w", t.ID(), err)
+		}
+		st.balances[o.address] = received
+	}
+	st.txIDs[id] = true
+	return nil
+}
+
+//transferUTXOを取り消す（baseを持たない状態にのみ使う）
+func (st *chainState) revertUTXO(t *Transaction) {
+	id := t.Hash()
+	for i, o := range t.outputs {
+		delete(st.utxos, OutPoint{TxID: id, Index: uint32(i)})
+		st.setBalance(o.address, st.balance(o.address)-o.value)
+	}
+	for i := len(t.inputs) - 1; i >= 0; i-- {
+		op := t.inputs[i].outPoint
+		prev := st.spent[op]
+		delete(st.spent, op)
+		st.utxos[op] = prev
+		st.setBalance(prev.address, st.balance(prev.address)+prev.value)
+	}
+	delete(st.txIDs, id)
+}
+
+//addressの使用できる未使用出力を返すメソッド
+//Poolで使用予定のものとまだ使えないマイニング報酬を除き、Poolで作られるものを含む
+func (bc *BlockChain) UTXOs(address string) []*UTXO {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+	st := bc.pendingState()
+	utxos := make([]*UTXO, 0)
+	for _, u := range st.unspentOutputs(address) {
+		if !st.isImmatureOutput(u.OutPoint) {
+			utxos = append(utxos, u)
+		}
+	}
+	return utxos
+}
+
+//UTXO方式のtransactionをPoolに追加し、他のノードと同期するメソッド
+func (bc *BlockChain) CreateUTXOTransaction(t *Transaction) bool {
+	isTransacted := bc.AddUTXOTransaction(t)
+	if isTransacted {
+		m, _ := json.Marshal(t)
+		bc.broadcastTransaction(m)
+	}
+	return isTransacted
+}
+
+//UTXO方式のtransactionをPoolに追加するメソッド
+func (bc *BlockChain) AddUTXOTransaction(t *Transaction) bool {
+	bc.mutexChain.Lock()
+	defer bc.mutexChain.Unlock()
+
+	if !t.IsUTXO() || t.IsCoinbase() {
+		log.Println("Error: not a UTXO transaction")
+		return false
+	}
+	return bc.admitTransaction(t)
+}
@@ -4,4 +4,8 @@ const (
 	CONTENT_TYPE string = "Content-Type"
 	APP_JSON     string = "application/json"
 	SELF_IP      string = "127.0.0.1"
+	//ノード間のrequestに付けるネットワークID
+	NETWORK_ID_HEADER string = "X-Network-ID"
+	//requestを送ったノードのアドレス（host:port）
+	NODE_ADDRESS_HEADER string = "X-Node-Address"
 )
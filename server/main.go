@@ -2,16 +2,65 @@ package main
 
 import (
 	"flag"
+	"gobc/block"
 	"log"
+	"runtime"
+	"strings"
 )
 
 func init() {
 	log.SetPrefix("NETWORK: ")
 }
 
+//Genesisファイルで決まるため-genesisと同時に指定できないflag
+var CONSENSUS_FLAGS = []string{
+	"block-interval", "retarget-interval", "max-block-bytes", "max-block-txs",
+	"initial-reward", "halving-interval", "max-supply", "coinbase-maturity", "ledger",
+}
+
 func main() {
 	port := flag.Uint("p", 3000, "TCP Port Number for Server")
+	dataDir := flag.String("datadir", "", "Directory to store the chain and miner wallet (in-memory if empty)")
+	genesisPath := flag.String("genesis", "", "Genesis JSON file defining the network (the built-in development network if empty)")
+	genesis := block.DefaultGenesis()
+	params := genesis.Params
+	flag.Int64Var(&params.TargetBlockIntervalSec, "block-interval", params.TargetBlockIntervalSec, "Target block interval in seconds")
+	flag.IntVar(&params.RetargetInterval, "retarget-interval", params.RetargetInterval, "Number of blocks between difficulty adjustments")
+	flag.IntVar(&params.MaxBlockBytes, "max-block-bytes", params.MaxBlockBytes, "Maximum block size in bytes")
+	flag.IntVar(&params.MaxBlockTransactions, "max-block-txs", params.MaxBlockTransactions, "Maximum number of transactions in a block including the reward")
+	flag.Var(&params.InitialReward, "initial-reward", "Mining reward of the first blocks")
+	flag.Uint64Var(&params.HalvingInterval, "halving-interval", params.HalvingInterval, "Number of blocks between reward halvings (0 disables halving)")
+	flag.Var(&params.MaxSupply, "max-supply", "Maximum amount ever issued including genesis allocations")
+	flag.Uint64Var(&params.CoinbaseMaturity, "coinbase-maturity", params.CoinbaseMaturity, "Number of blocks before a mining reward can be spent")
+	flag.StringVar(&params.LedgerMode, "ledger", params.LedgerMode, "Ledger mode of a new network (account or utxo)")
+	minerWorkers := flag.Int("miners", runtime.NumCPU(), "Number of goroutines searching for proof of work")
+	var peerConfig block.PeerConfig
+	seeds := flag.String("seeds", "", "Comma separated list of seed nodes (host:port)")
+	flag.StringVar(&peerConfig.Address, "addr", "", "Address advertised to other nodes (host:port, detected if empty)")
+	flag.IntVar(&peerConfig.TargetOutbound, "peers", block.TARGET_OUTBOUND_PEERS, "Number of outbound peers to keep")
+	flag.BoolVar(&peerConfig.Scan, "scan", false, "Discover nodes by scanning nearby IPs and ports (local development)")
 	flag.Parse()
-	app := NewServer(uint16(*port))
+	for _, seed := range strings.Split(*seeds, ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			peerConfig.Seeds = append(peerConfig.Seeds, seed)
+		}
+	}
+
+	if *genesisPath != "" {
+		flag.Visit(func(f *flag.Flag) {
+			for _, name := range CONSENSUS_FLAGS {
+				if f.Name == name {
+					log.Fatalf("Error: -%s cannot be used with -genesis (set it in the genesis file)", name)
+				}
+			}
+		})
+		var err error
+		if genesis, err = block.LoadGenesis(*genesisPath); err != nil {
+			log.Fatalf("Error: load genesis: %v", err)
+		}
+	} else if err := genesis.Validate(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	app := NewServer(uint16(*port), *dataDir, genesis, *minerWorkers, peerConfig)
 	app.Run()
 }
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"gobc/block"
 	"gobc/def"
 	"gobc/utils"
 	"gobc/wallet"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/fatih/color"
 )
@@ -17,13 +25,23 @@ import (
 //毎回reqest出さない
 var cache map[string]*block.BlockChain = make(map[string]*block.BlockChain)
 
+const WALLET_FILE = "wallet.json"
+
 type Server struct {
 	port uint16
+	//chainとminer walletの保存先（空ならメモリのみ）
+	dataDir string
+	genesis *block.Genesis
+	params  *block.Params
+	//PoWを探索するgoroutine数
+	minerWorkers int
+	//他のノードの探し方（AddressとBookPathは空ならportとdataDirから決める）
+	peerConfig block.PeerConfig
 }
 
 //create server
-func NewServer(port uint16) *Server {
-	return &Server{port: port}
+func NewServer(port uint16, dataDir string, genesis *block.Genesis, minerWorkers int, peerConfig block.PeerConfig) *Server {
+	return &Server{port: port, dataDir: dataDir, genesis: genesis, params: genesis.Params, minerWorkers: minerWorkers, peerConfig: peerConfig}
 }
 
 //return port
@@ -35,8 +53,15 @@ func (sv *Server) GetBlockChain() *block.BlockChain {
 	//キャッシュにあるか確認
 	bc, ok := cache["chain"]
 	if !ok {
-		minerWallet := wallet.NewWallet()
-		bc = block.NewBlockChain(minerWallet.Address(), sv.Port())
+		minerWallet := sv.loadMinerWallet()
+		storage := sv.openStorage()
+		var err error
+		bc, err = block.NewBlockChain(minerWallet.Address(), sv.Port(), storage, sv.genesis)
+		if err != nil {
+			log.Fatalf("Error: load blockchain: %v", err)
+		}
+		bc.SetMiner(block.NewMiner(sv.minerWorkers))
+		bc.SetPeerManager(block.NewPeerManager(sv.loadPeerConfig()))
 		cache["chain"] = bc
 		log.Printf("priKey  : %v", minerWallet.PrivateKeyStr())
 		log.Printf("pubKey  : %v", minerWallet.PublicKeyStr())
@@ -45,6 +70,103 @@ func (sv *Server) GetBlockChain() *block.BlockChain {
 	return bc
 }
 
+//他のノードの探し方の設定（アドレス帳はdataDirに保存する）
+func (sv *Server) loadPeerConfig() block.PeerConfig {
+	config := sv.peerConfig
+	if config.Address == "" {
+		config.Address = fmt.Sprintf("%s:%d", utils.GetHost(), sv.Port())
+	}
+	if config.BookPath == "" && sv.dataDir != "" {
+		config.BookPath = filepath.Join(sv.dataDir, block.PEERS_FILE)
+	}
+	return config
+}
+
+//dataDirが指定されていればファイル、なければメモリのストレージを返す
+func (sv *Server) openStorage() block.Storage {
+	if sv.dataDir == "" {
+		return block.NewMemoryStorage()
+	}
+	storage, err := block.NewFileStorage(sv.dataDir)
+	if err != nil {
+		log.Fatalf("Error: open storage: %v", err)
+	}
+	return storage
+}
+
+//dataDirに保存されたminer walletを読み込む（なければ作成して保存）
+func (sv *Server) loadMinerWallet() *wallet.Wallet {
+	if sv.dataDir == "" {
+		return wallet.NewWallet()
+	}
+	walletPath := filepath.Join(sv.dataDir, WALLET_FILE)
+	m, err := os.ReadFile(walletPath)
+	if err == nil {
+		w := new(wallet.Wallet)
+		if err := json.Unmarshal(m, w); err != nil {
+			log.Fatalf("Error: load wallet: %v", err)
+		}
+		return w
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Error: load wallet: %v", err)
+	}
+
+	w := wallet.NewWallet()
+	m, _ = w.MarshalJSON()
+	if err := os.MkdirAll(sv.dataDir, 0o755); err != nil {
+		log.Fatalf("Error: create data dir: %v", err)
+	}
+	if err := os.WriteFile(walletPath, m, 0o600); err != nil {
+		log.Fatalf("Error: store wallet: %v", err)
+	}
+	return w
+}
+
+//他のノードからのrequestのネットワークIDが異なれば拒否するhandler
+//（ネットワークIDを付けないwalletなどからのrequestはそのまま通す）
+func (sv *Server) sameNetwork(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if id := req.Header.Get(def.NETWORK_ID_HEADER); id != "" && id != sv.genesis.NetworkID {
+			log.Printf("Error: request from network %q (expected %q)", id, sv.genesis.NetworkID)
+			w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, string(utils.JsonStatus("network mismatch")))
+			return
+		}
+		handler(w, req)
+	}
+}
+
+//requestを送ってきたノードのIPアドレス（点数とbanのキー）
+//X-Node-Addressは自己申告なので使わない
+func peerKey(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+//banしたノードからのrequestを拒否するhandler
+func (sv *Server) notBanned(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if peer := peerKey(req); sv.GetBlockChain().Peers().IsBanned(peer) {
+			log.Printf("Error: request from banned peer %s", peer)
+			w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, string(utils.JsonStatus("banned")))
+			return
+		}
+		handler(w, req)
+	}
+}
+
+//他のノードからのrequestに不正があれば点数を加えるメソッド
+func (sv *Server) misbehaving(req *http.Request, misbehavior string, reason string) {
+	sv.GetBlockChain().Peers().Misbehaving(peerKey(req), misbehavior, reason)
+}
+
 func (sv *Server) GetChain(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
@@ -66,11 +188,13 @@ func (sv *Server) Transactions(w http.ResponseWriter, req *http.Request) {
 		bc := sv.GetBlockChain()
 		transactions := bc.TransactionPool()
 		m, _ := json.Marshal(struct {
-			Transactions []*block.Transaction `json:"transactions"`
-			Length       int                  `json:"length"`
+			Transactions []*block.Transaction        `json:"transactions"`
+			Length       int                         `json:"length"`
+			Dropped      []*block.DroppedTransaction `json:"dropped"`
 		}{
 			Transactions: transactions,
 			Length:       len(transactions),
+			Dropped:      bc.DroppedTransactions(),
 		})
 		io.WriteString(w, string(m[:]))
 
@@ -90,10 +214,21 @@ func (sv *Server) Transactions(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		pubKey := utils.StringToPublicKey(*t.SenderPublicKey)
-		signature := utils.StringToSignature(*t.Signature)
 		bc := sv.GetBlockChain()
-		isCreated := bc.CreateTransaction(*t.SenderAddress, *t.RecipientAddress, *t.Value, pubKey, signature)
+		var isCreated bool
+		if t.IsUTXO() {
+			isCreated = bc.CreateUTXOTransaction(block.NewUTXOTransaction(t.Inputs, t.Outputs, t.FeeOrZero()))
+		} else {
+			pubKey := utils.StringToPublicKey(*t.SenderPublicKey)
+			if !utils.IsAddressOf(*t.SenderAddress, pubKey) {
+				log.Println("Error: sender address does not match public key")
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+			signature := utils.StringToSignature(*t.Signature)
+			isCreated = bc.CreateTransaction(*t.SenderAddress, *t.RecipientAddress, *t.Value, t.FeeOrZero(), *t.Nonce, pubKey, signature)
+		}
 
 		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
 		var msg []byte
@@ -113,19 +248,41 @@ func (sv *Server) Transactions(w http.ResponseWriter, req *http.Request) {
 		err := dec.Decode(&t)
 		if err != nil {
 			log.Printf("Error: %v", err)
+			sv.misbehaving(req, block.MISBEHAVIOR_PROTOCOL, err.Error())
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
 		if !t.Validate() {
 			log.Println("Error: missing fields")
+			sv.misbehaving(req, block.MISBEHAVIOR_PROTOCOL, "missing fields")
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+
+		var tx *block.Transaction
+		if t.IsUTXO() {
+			tx = block.NewUTXOTransaction(t.Inputs, t.Outputs, t.FeeOrZero())
+		} else {
+			pubKey := utils.StringToPublicKey(*t.SenderPublicKey)
+			signature := utils.StringToSignature(*t.Signature)
+			tx = block.NewTransaction(*t.SenderAddress, *t.RecipientAddress, *t.Value, t.FeeOrZero(), *t.Nonce, pubKey, signature)
+		}
+		//署名が不正なものだけ点数を加える（重複や残高不足、Poolが満杯などは正常な同期でも起こる）
+		if !tx.HasValidSignatures() {
+			log.Printf("Error: transaction %s has an invalid signature", tx.ID())
+			sv.misbehaving(req, block.MISBEHAVIOR_INVALID_TRANSACTION, "invalid signature")
+			w.WriteHeader(http.StatusBadRequest)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
 
-		pubKey := utils.StringToPublicKey(*t.SenderPublicKey)
-		signature := utils.StringToSignature(*t.Signature)
 		bc := sv.GetBlockChain()
-		isUpdated := bc.AddTransaction(*t.SenderAddress, *t.RecipientAddress, *t.Value, pubKey, signature)
+		var isUpdated bool
+		if t.IsUTXO() {
+			isUpdated = bc.AddUTXOTransaction(tx)
+		} else {
+			isUpdated = bc.AddTransaction(tx.SenderAddress(), tx.RecipientAddress(), tx.Value(), tx.Fee(), tx.Nonce(), tx.SenderPublicKey(), tx.Signature())
+		}
 
 		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
 		var msg []byte
@@ -186,14 +343,42 @@ func (sv *Server) StartMining(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+//マイナーの状態（worker数とhashrate）を返すAPI
+func (sv *Server) MiningStatus(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		miner := sv.GetBlockChain().Miner()
+		m, _ := json.Marshal(struct {
+			Workers  int     `json:"workers"`
+			Hashrate float64 `json:"hashrate"`
+		}{
+			Workers:  miner.Workers(),
+			Hashrate: miner.Hashrate(),
+		})
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println("Error: Invalid http method")
+	}
+}
+
 //queryのaddressに対して残高を返すAPI
 func (sv *Server) Amount(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		bc := sv.GetBlockChain()
 		address := req.URL.Query().Get("address")
-		amount := bc.CalculateTotalAmount(address)
-		res := &block.AmountResponse{Amount: amount}
+		amount, err := bc.CalculateTotalAmount(address)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		immature := bc.ImmatureAmount(address)
+		res := &block.AmountResponse{Amount: amount, Immature: immature, Spendable: amount - immature}
 		m, _ := res.MarshalJSON()
 		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
 		io.WriteString(w, string(m[:]))
@@ -204,6 +389,645 @@ func (sv *Server) Amount(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+//queryのaddressが次に使うnonceを返すAPI
+func (sv *Server) Nonce(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := sv.GetBlockChain()
+		address := req.URL.Query().Get("address")
+		m, _ := json.Marshal(struct {
+			Nonce uint64 `json:"nonce"`
+		}{
+			Nonce: bc.NextNonce(address),
+		})
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//queryのidのtransactionがBlockに含まれることのMerkle証明を返すAPI
+func (sv *Server) MerkleProof(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		var id [32]byte
+		idBytes, err := hex.DecodeString(req.URL.Query().Get("id"))
+		if err != nil || len(idBytes) != 32 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("invalid id")))
+			return
+		}
+		copy(id[:], idBytes)
+
+		b, proof, err := sv.GetBlockChain().TransactionProof(id)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JsonStatus("not found")))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			BlockHash string             `json:"block_hash"`
+			Header    *block.BlockHeader `json:"header"`
+			Proof     *block.MerkleProof `json:"proof"`
+		}{
+			BlockHash: fmt.Sprintf("%x", b.Hash()),
+			Header:    b.Header(),
+			Proof:     proof,
+		})
+		io.WriteString(w, string(m[:]))
+
+	//証明がmerkle_rootと一致するか検証
+	case http.MethodPost:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		var proof block.MerkleProof
+		if err := json.NewDecoder(req.Body).Decode(&proof); err != nil {
+			log.Printf("Error: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		var root [32]byte
+		rootBytes, err := hex.DecodeString(proof.MerkleRoot)
+		if err != nil || len(rootBytes) != 32 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("invalid merkle_root")))
+			return
+		}
+		copy(root[:], rootBytes)
+		m, _ := json.Marshal(struct {
+			Valid bool `json:"valid"`
+		}{
+			Valid: block.VerifyMerkleProof(&proof, root),
+		})
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//16進文字列のhashを変換
+func parseHash(s string) ([32]byte, bool) {
+	var hash [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return hash, false
+	}
+	copy(hash[:], b)
+	return hash, true
+}
+
+//Blockの一覧を高さfromからlimit個返すAPI（POSTでは他のノードのBlockを受け取る）
+func (sv *Server) Blocks(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		query := req.URL.Query()
+		var from uint64 = 0
+		limit := 20
+		if s := query.Get("from"); s != "" {
+			v, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("invalid from")))
+				return
+			}
+			from = v
+		}
+		if s := query.Get("limit"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v <= 0 || v > block.MAX_BLOCKS_PER_PAGE {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("invalid limit")))
+				return
+			}
+			limit = v
+		}
+
+		bc := sv.GetBlockChain()
+		blocks := bc.Blocks(from, limit)
+		tip := bc.Tip()
+		//次のページの開始位置（最後まで返した場合はnull）
+		var next *uint64
+		if n := from + uint64(len(blocks)); len(blocks) > 0 && n <= tip.Height() {
+			next = &n
+		}
+		m, _ := json.Marshal(struct {
+			Blocks    []*block.Block `json:"blocks"`
+			Next      *uint64        `json:"next"`
+			TipHeight uint64         `json:"tip_height"`
+		}{
+			Blocks:    blocks,
+			Next:      next,
+			TipHeight: tip.Height(),
+		})
+		io.WriteString(w, string(m[:]))
+
+	//他のノードがマイニングしたBlockを受け取る
+	case http.MethodPost:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		var b block.Block
+		if err := json.NewDecoder(req.Body).Decode(&b); err != nil {
+			log.Printf("Error: %v", err)
+			sv.misbehaving(req, block.MISBEHAVIOR_PROTOCOL, err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("invalid block")))
+			return
+		}
+		//同期に使う送信元のアドレスは、接続元のhostと一致する場合のみ信用する
+		from := req.Header.Get(def.NODE_ADDRESS_HEADER)
+		if host, _, err := net.SplitHostPort(from); err != nil || host != peerKey(req) {
+			from = ""
+		}
+		status, err := sv.GetBlockChain().ReceiveBlock(&b, from)
+		if err != nil {
+			log.Printf("Error: block %d from %s rejected: %v", b.Height(), from, err)
+			if errors.Is(err, block.ErrInvalidBlock) {
+				sv.misbehaving(req, block.MISBEHAVIOR_INVALID_BLOCK, err.Error())
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus(err.Error())))
+			return
+		}
+		if status == block.BLOCK_SYNCING {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		io.WriteString(w, string(utils.JsonStatus(status)))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//1つのBlockを返すAPI（/blocks/{height} または /blocks/hash/{hash}）
+func (sv *Server) BlockByKey(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		bc := sv.GetBlockChain()
+		key := strings.TrimPrefix(req.URL.Path, "/blocks/")
+		var b *block.Block
+		if hashStr := strings.TrimPrefix(key, "hash/"); hashStr != key {
+			hash, ok := parseHash(hashStr)
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("invalid hash")))
+				return
+			}
+			b = bc.BlockByHash(hash)
+		} else {
+			height, err := strconv.ParseUint(key, 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("invalid height")))
+				return
+			}
+			b = bc.BlockByHeight(height)
+		}
+		if b == nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JsonStatus("not found")))
+			return
+		}
+		m, _ := b.MarshalJSON()
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//locatorの後のBlockのヘッダーを返すAPI（locatorはカンマ区切りのBlockのhash）
+func (sv *Server) Headers(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		query := req.URL.Query()
+		locator := make([][32]byte, 0)
+		if s := query.Get("locator"); s != "" {
+			for _, hashStr := range strings.Split(s, ",") {
+				hash, ok := parseHash(hashStr)
+				if !ok {
+					w.WriteHeader(http.StatusBadRequest)
+					io.WriteString(w, string(utils.JsonStatus("invalid locator")))
+					return
+				}
+				locator = append(locator, hash)
+			}
+		}
+		limit := block.MAX_HEADERS_PER_PAGE
+		if s := query.Get("limit"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v <= 0 || v > block.MAX_HEADERS_PER_PAGE {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("invalid limit")))
+				return
+			}
+			limit = v
+		}
+		headers := sv.GetBlockChain().HeadersAfter(locator, limit)
+		m, _ := json.Marshal(struct {
+			Headers []*block.BlockHeader `json:"headers"`
+		}{
+			Headers: headers,
+		})
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//他のノードとのhandshakeのAPI（互換性があれば自身の情報を返す）
+func (sv *Server) Handshake(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		v := new(block.PeerVersion)
+		if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+			log.Printf("Error: %v", err)
+			sv.misbehaving(req, block.MISBEHAVIOR_PROTOCOL, err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("invalid version")))
+			return
+		}
+		local, err := sv.GetBlockChain().AcceptHandshake(v)
+		if err != nil {
+			log.Printf("Error: handshake from %s rejected: %v", v.ListenAddress(), err)
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, string(utils.JsonStatus(err.Error())))
+			return
+		}
+		m, _ := local.MarshalJSON()
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//知っているノードのアドレスを返すAPI（requestを送ってきたノードはアドレス帳に追加する）
+func (sv *Server) Peers(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		pm := sv.GetBlockChain().Peers()
+		if from := req.Header.Get(def.NODE_ADDRESS_HEADER); from != "" {
+			pm.AddAddress(from)
+		}
+		type connectedPeer struct {
+			Address string             `json:"address"`
+			Version *block.PeerVersion `json:"version,omitempty"`
+		}
+		outbound := make([]*connectedPeer, 0)
+		for _, address := range pm.Outbound() {
+			outbound = append(outbound, &connectedPeer{Address: address, Version: pm.Version(address)})
+		}
+		m, _ := json.Marshal(struct {
+			Peers    []string         `json:"peers"`
+			Outbound []*connectedPeer `json:"outbound"`
+		}{
+			Peers:    pm.KnownPeers(),
+			Outbound: outbound,
+		})
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//不正な行為の点数とbanの一覧を返すAPI（DELETEでは?address=のbanを解除する）
+//自身のマシンからのrequestのみ受け付ける
+func (sv *Server) AdminPeers(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+	host, _, _ := net.SplitHostPort(req.RemoteAddr)
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		log.Printf("Error: admin request from %s", req.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, string(utils.JsonStatus("forbidden")))
+		return
+	}
+
+	pm := sv.GetBlockChain().Peers()
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(struct {
+			Peers        []*block.PeerScore `json:"peers"`
+			BanThreshold int                `json:"ban_threshold"`
+		}{
+			Peers:        pm.Scores(),
+			BanThreshold: block.BAN_THRESHOLD,
+		})
+		io.WriteString(w, string(m[:]))
+
+	case http.MethodDelete:
+		address := req.URL.Query().Get("address")
+		if !pm.Unban(address) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JsonStatus("not found")))
+			return
+		}
+		io.WriteString(w, string(utils.JsonStatus("unbanned")))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//他のノードとの同期の進捗を返すAPI
+func (sv *Server) SyncStatus(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := sv.GetBlockChain().SyncProgress().MarshalJSON()
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//chainの先頭のBlockの情報を返すAPI
+func (sv *Server) Tip(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := sv.GetBlockChain()
+		tip := bc.Tip()
+		m, _ := json.Marshal(struct {
+			Height uint64             `json:"height"`
+			Hash   string             `json:"hash"`
+			Header *block.BlockHeader `json:"header"`
+		}{
+			Height: tip.Height(),
+			Hash:   fmt.Sprintf("%x", tip.Hash()),
+			Header: tip.Header(),
+		})
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//IDのtransactionの状態を返すAPI（/tx/{id}）
+func (sv *Server) TransactionByID(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		id, ok := parseHash(strings.TrimPrefix(req.URL.Path, "/tx/"))
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("invalid id")))
+			return
+		}
+		status := sv.GetBlockChain().TransactionByID(id)
+		if status == nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JsonStatus("not found")))
+			return
+		}
+		m, _ := status.MarshalJSON()
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//addressの承認済みtransactionを新しい順に返すAPI（/address/{addr}/transactions?cursor=&limit=）
+func (sv *Server) AddressTransactions(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		path := strings.TrimPrefix(req.URL.Path, "/address/")
+		address := strings.TrimSuffix(path, "/transactions")
+		if address == path || address == "" || strings.Contains(address, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JsonStatus("not found")))
+			return
+		}
+		query := req.URL.Query()
+		cursor := -1
+		limit := 20
+		if s := query.Get("cursor"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("invalid cursor")))
+				return
+			}
+			cursor = v
+		}
+		if s := query.Get("limit"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v <= 0 || v > block.MAX_TRANSACTIONS_PER_PAGE {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("invalid limit")))
+				return
+			}
+			limit = v
+		}
+
+		statuses, next := sv.GetBlockChain().AddressTransactions(address, cursor, limit)
+		//続きがなければnull
+		var nextCursor *int
+		if next >= 0 {
+			nextCursor = &next
+		}
+		m, _ := json.Marshal(struct {
+			Address      string                     `json:"address"`
+			Transactions []*block.TransactionStatus `json:"transactions"`
+			NextCursor   *int                       `json:"next_cursor"`
+		}{
+			Address:      address,
+			Transactions: statuses,
+			NextCursor:   nextCursor,
+		})
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//残高の状態をchainから作り直した状態と比較するAPI（repair=trueなら不一致の場合に作り直す）
+func (sv *Server) CheckState(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := sv.GetBlockChain()
+		err := bc.CheckState()
+		repaired := false
+		if err != nil {
+			log.Printf("Error: %v", err)
+			if req.URL.Query().Get("repair") == "true" {
+				bc.RebuildState()
+				repaired = true
+			}
+		}
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		m, _ := json.Marshal(struct {
+			Consistent bool   `json:"consistent"`
+			Error      string `json:"error,omitempty"`
+			Repaired   bool   `json:"repaired"`
+		}{
+			Consistent: err == nil,
+			Error:      errStr,
+			Repaired:   repaired,
+		})
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//queryのaddressの未使用出力を返すAPI（UTXO方式のみ）
+func (sv *Server) UTXOs(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		if !sv.params.IsUTXO() {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("ledger is not utxo")))
+			return
+		}
+		address := req.URL.Query().Get("address")
+		utxos := sv.GetBlockChain().UTXOs(address)
+		if utxos == nil {
+			utxos = []*block.UTXO{}
+		}
+		m, _ := json.Marshal(struct {
+			UTXOs []*block.UTXO `json:"utxos"`
+		}{
+			UTXOs: utxos,
+		})
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//ネットワークのパラメータを返すAPI
+func (sv *Server) Params(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(sv.params)
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//ネットワークの定義とGenesis Blockのhashを返すAPI
+func (sv *Server) Genesis(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := sv.GetBlockChain()
+		m, _ := json.Marshal(struct {
+			Hash string `json:"hash"`
+			*block.Genesis
+		}{
+			Hash:    fmt.Sprintf("%x", bc.GenesisHash()),
+			Genesis: sv.genesis,
+		})
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//手数料の推定値を返すAPI（sizeはtransactionのbyte数、省略した場合は一般的なサイズ）
+func (sv *Server) EstimateFee(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		size := block.TYPICAL_TRANSACTION_SIZE
+		if s := req.URL.Query().Get("size"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("invalid size")))
+				return
+			}
+			size = v
+		}
+		rate := sv.GetBlockChain().EstimateFeeRate()
+		m, _ := json.Marshal(struct {
+			FeeRate float64      `json:"fee_rate"`
+			Size    int          `json:"size"`
+			Fee     utils.Amount `json:"fee"`
+		}{
+			FeeRate: rate,
+			Size:    size,
+			Fee:     utils.Amount(math.Ceil(rate * float64(size))),
+		})
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+//発行済みの量と次のマイニング報酬を返すAPI
+func (sv *Server) Supply(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := sv.GetBlockChain()
+		height := bc.Tip().Height()
+		allocated, _ := sv.genesis.AllocatedSupply()
+		m, _ := json.Marshal(struct {
+			Height            uint64       `json:"height"`
+			GenesisAllocation utils.Amount `json:"genesis_allocation"`
+			CirculatingSupply utils.Amount `json:"circulating_supply"`
+			MaxSupply         utils.Amount `json:"max_supply"`
+			NextReward        utils.Amount `json:"next_reward"`
+		}{
+			Height:            height,
+			GenesisAllocation: allocated,
+			CirculatingSupply: allocated + sv.params.SupplyAt(height),
+			MaxSupply:         sv.params.MaxSupply,
+			NextReward:        sv.params.RewardForHeight(height + 1),
+		})
+		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
+		io.WriteString(w, string(m[:]))
+
+	default:
+		log.Println("Error: Invalid http method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
 //コンセンサスAPI
 func (sv *Server) Consensus(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
@@ -226,12 +1050,31 @@ func (sv *Server) Consensus(w http.ResponseWriter, req *http.Request) {
 
 func (sv *Server) Run() {
 	sv.GetBlockChain().Run()
-	http.HandleFunc("/", sv.GetChain)
-	http.HandleFunc("/transactions", sv.Transactions)
+	http.HandleFunc("/", sv.notBanned(sv.sameNetwork(sv.GetChain)))
+	http.HandleFunc("/transactions", sv.notBanned(sv.sameNetwork(sv.Transactions)))
 	http.HandleFunc("/mine", sv.Mine)
 	http.HandleFunc("/mine/start", sv.StartMining)
+	http.HandleFunc("/mine/status", sv.MiningStatus)
 	http.HandleFunc("/amount", sv.Amount)
-	http.HandleFunc("/consensus", sv.Consensus)
+	http.HandleFunc("/nonce", sv.Nonce)
+	http.HandleFunc("/consensus", sv.notBanned(sv.sameNetwork(sv.Consensus)))
+	http.HandleFunc("/merkle/proof", sv.MerkleProof)
+	http.HandleFunc("/blocks", sv.notBanned(sv.sameNetwork(sv.Blocks)))
+	http.HandleFunc("/blocks/", sv.notBanned(sv.sameNetwork(sv.BlockByKey)))
+	http.HandleFunc("/tip", sv.Tip)
+	http.HandleFunc("/headers", sv.notBanned(sv.sameNetwork(sv.Headers)))
+	http.HandleFunc("/sync", sv.SyncStatus)
+	http.HandleFunc("/peers", sv.notBanned(sv.sameNetwork(sv.Peers)))
+	http.HandleFunc("/handshake", sv.notBanned(sv.Handshake))
+	http.HandleFunc("/admin/peers", sv.AdminPeers)
+	http.HandleFunc("/tx/", sv.TransactionByID)
+	http.HandleFunc("/address/", sv.AddressTransactions)
+	http.HandleFunc("/state/check", sv.CheckState)
+	http.HandleFunc("/utxos", sv.UTXOs)
+	http.HandleFunc("/params", sv.Params)
+	http.HandleFunc("/genesis", sv.Genesis)
+	http.HandleFunc("/fees/estimate", sv.EstimateFee)
+	http.HandleFunc("/supply", sv.Supply)
 	color.Green("Blockchain Server started on PORT: %v\n", sv.Port())
 	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(sv.Port())), nil))
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"gobc/def"
+	"net/http/httptest"
+	"testing"
+)
+
+//点数とbanのキーは接続元のIPアドレスだけで決まり、X-Node-Addressやportを変えても同じになる
+func TestPeerKeyIgnoresAdvertisedAddress(t *testing.T) {
+	cases := []struct {
+		remoteAddr string
+		header     string
+	}{
+		{"10.0.0.1:50000", ""},
+		{"10.0.0.1:50001", "10.0.0.1:3001"},
+		{"10.0.0.1:50002", "10.0.0.1:4000"},
+		{"10.0.0.1:50003", "10.0.0.9:3001"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/blocks", nil)
+		req.RemoteAddr = c.remoteAddr
+		if c.header != "" {
+			req.Header.Set(def.NODE_ADDRESS_HEADER, c.header)
+		}
+		if key := peerKey(req); key != "10.0.0.1" {
+			t.Errorf("peerKey(%s, %q) = %s, want 10.0.0.1", c.remoteAddr, c.header, key)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//金額（最小単位 10^-8 の整数で保持する）
+type Amount int64
+
+const (
+	AMOUNT_DECIMALS        = 8
+	COIN            Amount = 100000000
+	MAX_AMOUNT      Amount = math.MaxInt64
+)
+
+var (
+	ErrAmountOverflow = errors.New("amount overflow")
+	ErrAmountSyntax   = errors.New("invalid amount")
+)
+
+//"12.345"のような10進文字列を誤差なくAmountに変換
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "-") {
+		neg = true
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, ErrAmountSyntax
+	}
+	if len(fracPart) > AMOUNT_DECIMALS {
+		return 0, fmt.Errorf("%w: more than %d decimals", ErrAmountSyntax, AMOUNT_DECIMALS)
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, ErrAmountSyntax
+	}
+
+	var whole uint64 = 0
+	if intPart != "" {
+		v, err := strconv.ParseUint(intPart, 10, 64)
+		if err != nil {
+			return 0, ErrAmountOverflow
+		}
+		whole = v
+	}
+	var frac uint64 = 0
+	if fracPart != "" {
+		fracPart += strings.Repeat("0", AMOUNT_DECIMALS-len(fracPart))
+		frac, _ = strconv.ParseUint(fracPart, 10, 64)
+	}
+	if whole > uint64(MAX_AMOUNT/COIN) {
+		return 0, ErrAmountOverflow
+	}
+	a, err := (Amount(whole) * COIN).Add(Amount(frac))
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		a = -a
+	}
+	return a, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+//末尾の0を省いた10進文字列（"1", "0.5"）
+func (a Amount) String() string {
+	sign := ""
+	u := uint64(a)
+	if a < 0 {
+		sign = "-"
+		u = uint64(-a)
+	}
+	whole := u / uint64(COIN)
+	frac := u % uint64(COIN)
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	fracStr := strings.TrimRight(fmt.Sprintf("%0*d", AMOUNT_DECIMALS, frac), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, fracStr)
+}
+
+//オーバーフローを検出する加算
+func (a Amount) Add(b Amount) (Amount, error) {
+	if (b > 0 && a > MAX_AMOUNT-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
+
+//flag.Valueとしてコマンドライン引数から設定する
+func (a *Amount) Set(s string) error {
+	v, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+//JSONでは精度を落とさないよう文字列で扱う
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+//"1.5"（文字列）と1.5（数値リテラル）の両方を受け付ける
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	v, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{"0", 0, nil},
+		{"1", COIN, nil},
+		{" 12.345 ", 12*COIN + 34500000, nil},
+		{"0.00000001", 1, nil},
+		{".5", COIN / 2, nil},
+		{"1.", COIN, nil},
+		{"-0.5", -COIN / 2, nil},
+		{"-92233720368.54775807", -MAX_AMOUNT, nil},
+		{"92233720368.54775807", MAX_AMOUNT, nil},
+		//小数点以下8桁を超えるものは丸めずに拒否する
+		{"0.000000001", 0, ErrAmountSyntax},
+		{"1.123456789", 0, ErrAmountSyntax},
+		{"92233720368.54775808", 0, ErrAmountOverflow},
+		{"92233720369", 0, ErrAmountOverflow},
+		{"-92233720368.54775808", 0, ErrAmountOverflow},
+		{"18446744073709551616", 0, ErrAmountOverflow},
+		{"", 0, ErrAmountSyntax},
+		{"-", 0, ErrAmountSyntax},
+		{".", 0, ErrAmountSyntax},
+		{"--1", 0, ErrAmountSyntax},
+		{"+1", 0, ErrAmountSyntax},
+		{"1e8", 0, ErrAmountSyntax},
+		{"1.2.3", 0, ErrAmountSyntax},
+	}
+	for _, c := range cases {
+		got, err := ParseAmount(c.in)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("ParseAmount(%q) = %d, %v, want error %v", c.in, got, err, c.err)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", c.in, got, err, c.want)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	cases := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{COIN, "1"},
+		{COIN / 2, "0.5"},
+		{12*COIN + 34500000, "12.345"},
+		{-COIN / 2, "-0.5"},
+		{-1, "-0.00000001"},
+		{MAX_AMOUNT, "92233720368.54775807"},
+		{math.MinInt64, "-92233720368.54775808"},
+	}
+	for _, c := range cases {
+		if got := c.in.String(); got != c.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(c.in), got, c.want)
+		}
+		//MinInt64以外は文字列から元の値に戻せる
+		if c.in == math.MinInt64 {
+			continue
+		}
+		if back, err := ParseAmount(c.want); err != nil || back != c.in {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", c.want, back, err, c.in)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package utils
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"math/big"
+
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
 )
 
 //Signatureの情報
@@ -53,3 +57,44 @@ func StringToBigInts(s string) (big.Int, big.Int) {
 	_ = biy.SetBytes(by)
 	return bix, biy
 }
+
+func PublicKeyToString(pubKey *ecdsa.PublicKey) string {
+	return fmt.Sprintf("%064x%064x", pubKey.X.Bytes(), pubKey.Y.Bytes())
+}
+
+//publicKeyからアドレスを生成（bitcoinと同じアドレス生成手順）
+func PublicKeyToAddress(pubKey *ecdsa.PublicKey) string {
+	h2 := sha256.New()
+	h2.Write(pubKey.X.Bytes())
+	h2.Write(pubKey.Y.Bytes())
+	result2 := h2.Sum(nil)
+
+	h3 := ripemd160.New()
+	h3.Write(result2)
+	result3 := h3.Sum(nil)
+
+	vd4 := make([]byte, 21)
+	vd4[0] = 0x00
+	copy(vd4[1:], result3[:])
+
+	h5 := sha256.New()
+	h5.Write(vd4)
+	result5 := h5.Sum(nil)
+
+	h6 := sha256.New()
+	h6.Write(result5)
+	result6 := h6.Sum(nil)
+
+	chsum := result6[:4]
+
+	dc8 := make([]byte, 25)
+	copy(dc8[:21], vd4[:])
+	copy(dc8[21:], chsum[:])
+
+	return base58.Encode(dc8)
+}
+
+//addressがpubKeyから生成されたものか判定
+func IsAddressOf(address string, pubKey *ecdsa.PublicKey) bool {
+	return pubKey != nil && pubKey.X != nil && pubKey.Y != nil && PublicKeyToAddress(pubKey) == address
+}
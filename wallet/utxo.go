@@ -0,0 +1,138 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"gobc/utils"
+	"sort"
+)
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+//ノードから取得した未使用出力
+type UTXO struct {
+	TxID    string       `json:"tx_id"`
+	Index   uint32       `json:"index"`
+	Address string       `json:"address"`
+	Value   utils.Amount `json:"value"`
+}
+
+//transactionの出力
+type TxOutput struct {
+	Address string       `json:"address"`
+	Value   utils.Amount `json:"value"`
+}
+
+//署名済みの入力（ノードへのrequest用）
+type TxInput struct {
+	TxID      string `json:"tx_id"`
+	Index     uint32 `json:"index"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+//valueを支払うのに使う未使用出力を大きいものから選び、おつりを返す
+func SelectCoins(utxos []*UTXO, value utils.Amount) ([]*UTXO, utils.Amount, error) {
+	sorted := append([]*UTXO{}, utxos...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Value > sorted[j].Value
+	})
+	selected := make([]*UTXO, 0)
+	var total utils.Amount = 0
+	for _, u := range sorted {
+		if total >= value {
+			break
+		}
+		var err error
+		if total, err = total.Add(u.Value); err != nil {
+			return nil, 0, err
+		}
+		selected = append(selected, u)
+	}
+	if total < value {
+		return nil, 0, ErrInsufficientFunds
+	}
+	return selected, total - value, nil
+}
+
+//walletからのUTXO方式のtransaction情報（入力は全てこのwalletの鍵で署名する）
+type UTXOTransaction struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  *ecdsa.PublicKey
+	inputs     []*UTXO
+	outputs    []*TxOutput
+	fee        utils.Amount
+}
+
+func NewUTXOTransaction(priKey *ecdsa.PrivateKey, pubKey *ecdsa.PublicKey, inputs []*UTXO, outputs []*TxOutput, fee utils.Amount) *UTXOTransaction {
+	return &UTXOTransaction{priKey, pubKey, inputs, outputs, fee}
+}
+
+//recipientにvalueを送り、手数料を除いたおつりをsenderに戻すtransactionを作成
+func NewPayment(priKey *ecdsa.PrivateKey, pubKey *ecdsa.PublicKey, sender string, recipient string, value utils.Amount, fee utils.Amount, utxos []*UTXO) (*UTXOTransaction, error) {
+	total, err := value.Add(fee)
+	if err != nil {
+		return nil, err
+	}
+	inputs, change, err := SelectCoins(utxos, total)
+	if err != nil {
+		return nil, err
+	}
+	outputs := []*TxOutput{{Address: recipient, Value: value}}
+	if change > 0 {
+		outputs = append(outputs, &TxOutput{Address: sender, Value: change})
+	}
+	return NewUTXOTransaction(priKey, pubKey, inputs, outputs, fee), nil
+}
+
+func (t *UTXOTransaction) Outputs() []*TxOutput {
+	return t.outputs
+}
+
+func (t *UTXOTransaction) Fee() utils.Amount {
+	return t.fee
+}
+
+//入力ごとの署名を生成し、署名済みの入力を返すメソッド
+func (t *UTXOTransaction) SignInputs() []*TxInput {
+	m, _ := json.Marshal(t)
+	h := sha256.Sum256(m)
+	pubKeyStr := utils.PublicKeyToString(t.publicKey)
+	inputs := make([]*TxInput, len(t.inputs))
+	for i, u := range t.inputs {
+		r, s, _ := ecdsa.Sign(rand.Reader, t.privateKey, h[:])
+		inputs[i] = &TxInput{
+			TxID:      u.TxID,
+			Index:     u.Index,
+			PublicKey: pubKeyStr,
+			Signature: (&utils.Signature{R: r, S: s}).String(),
+		}
+	}
+	return inputs
+}
+
+//署名対象のJSON（block.Transactionと同じ形式）
+func (t *UTXOTransaction) MarshalJSON() ([]byte, error) {
+	type outPoint struct {
+		TxID  string `json:"tx_id"`
+		Index uint32 `json:"index"`
+	}
+	inputs := make([]outPoint, len(t.inputs))
+	for i, u := range t.inputs {
+		inputs[i] = outPoint{TxID: u.TxID, Index: u.Index}
+	}
+	return json.Marshal(struct {
+		Inputs  []outPoint   `json:"inputs"`
+		Outputs []*TxOutput  `json:"outputs"`
+		Fee     utils.Amount `json:"fee,omitempty"`
+		Nonce   uint64       `json:"nonce"`
+	}{
+		Inputs:  inputs,
+		Outputs: t.outputs,
+		Fee:     t.fee,
+		Nonce:   0,
+	})
+}
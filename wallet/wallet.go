@@ -6,11 +6,9 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gobc/utils"
-
-	"github.com/btcsuite/btcutil/base58"
-	"golang.org/x/crypto/ripemd160"
 )
 
 //Walletの情報
@@ -32,44 +30,35 @@ func (w *Wallet) MarshalJSON() ([]byte, error) {
 	})
 }
 
+//MarshalJSONで保存したwalletを復元する
+func (w *Wallet) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		Privatekey string `json:"private_key"`
+		PublicKey  string `json:"public_key"`
+		Adddress   string `json:"address"`
+	}{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if len(v.PublicKey) != 128 || v.Privatekey == "" || v.Adddress == "" {
+		return errors.New("invalid wallet")
+	}
+	w.publicKey = utils.StringToPublicKey(v.PublicKey)
+	if !utils.IsAddressOf(v.Adddress, w.publicKey) {
+		return errors.New("address does not match public key")
+	}
+	w.privateKey = utils.StringToPrivateKey(v.Privatekey, w.publicKey)
+	w.address = v.Adddress
+	return nil
+}
+
 //Wallet作成
 func NewWallet() *Wallet {
 	w := new(Wallet)
 	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	w.privateKey = privateKey
 	w.publicKey = &w.privateKey.PublicKey
-
-	//bitcoinと同じアドレス生成手順
-	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
-	result2 := h2.Sum(nil)
-
-	h3 := ripemd160.New()
-	h3.Write(result2)
-	result3 := h3.Sum(nil)
-
-	vd4 := make([]byte, 21)
-	vd4[0] = 0x00
-	copy(vd4[1:], result3[:])
-
-	h5 := sha256.New()
-	h5.Write(vd4)
-	result5 := h5.Sum(nil)
-
-	h6 := sha256.New()
-	h6.Write(result5)
-	result6 := h6.Sum(nil)
-
-	chsum := result6[:4]
-
-	dc8 := make([]byte, 25)
-	copy(dc8[:21], vd4[:])
-	copy(dc8[21:], chsum[:])
-
-	address := base58.Encode(dc8)
-	w.address = address
-
+	w.address = utils.PublicKeyToAddress(w.publicKey)
 	return w
 }
 
@@ -95,7 +84,7 @@ func (w *Wallet) PublicKey() *ecdsa.PublicKey {
 
 //publicKeyの文字を返すメソッド
 func (w *Wallet) PublicKeyStr() string {
-	return fmt.Sprintf("%064x%064x", w.publicKey.X.Bytes(), w.publicKey.Y.Bytes())
+	return utils.PublicKeyToString(w.publicKey)
 }
 
 //walletからのtransaction情報
@@ -104,12 +93,14 @@ type Transaction struct {
 	senderPublicKey  *ecdsa.PublicKey
 	senderAddress    string
 	recipientAddress string
-	value            float32
+	value            utils.Amount
+	fee              utils.Amount
+	nonce            uint64
 }
 
 //transactionを作成するメソッド
-func NewTransaction(priKey *ecdsa.PrivateKey, pubKey *ecdsa.PublicKey, sender string, recipient string, value float32) *Transaction {
-	return &Transaction{priKey, pubKey, sender, recipient, value}
+func NewTransaction(priKey *ecdsa.PrivateKey, pubKey *ecdsa.PublicKey, sender string, recipient string, value utils.Amount, fee utils.Amount, nonce uint64) *Transaction {
+	return &Transaction{priKey, pubKey, sender, recipient, value, fee, nonce}
 }
 
 //Signature生成メソッド
@@ -123,13 +114,17 @@ func (t *Transaction) GenSignature() *utils.Signature {
 //marshalメソッドカスタム
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_address"`
-		Recipient string  `json:"recipient_address"`
-		Value     float32 `json:"value"`
+		Sender    string       `json:"sender_address"`
+		Recipient string       `json:"recipient_address"`
+		Value     utils.Amount `json:"value"`
+		Fee       utils.Amount `json:"fee,omitempty"`
+		Nonce     uint64       `json:"nonce"`
 	}{
 		Sender:    t.senderAddress,
 		Recipient: t.recipientAddress,
 		Value:     t.value,
+		Fee:       t.fee,
+		Nonce:     t.nonce,
 	})
 }
 
@@ -140,6 +135,7 @@ type TransactionRequest struct {
 	SenderAddress    *string `json:"sender_address"`
 	RecipientAddress *string `json:"recipient_address"`
 	Value            *string `json:"value"`
+	Fee              *string `json:"fee"` //省略した場合は0
 }
 
 //requestのValidate
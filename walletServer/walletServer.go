@@ -12,6 +12,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"path"
 	"strconv"
 
@@ -85,29 +86,78 @@ func (wsv *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Requ
 
 		pubKey := utils.StringToPublicKey(*t.SenderPublicKey)
 		priKey := utils.StringToPrivateKey(*t.SenderPrivateKey, pubKey)
-		value, err := strconv.ParseFloat(*t.Value, 32)
-		if err != nil {
+		value, err := utils.ParseAmount(*t.Value)
+		if err != nil || value <= 0 {
 			log.Println("Error: Parse error")
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
-		value32 := float32(value)
+		var fee utils.Amount = 0
+		if t.Fee != nil && *t.Fee != "" {
+			fee, err = utils.ParseAmount(*t.Fee)
+			if err != nil || fee < 0 {
+				log.Println("Error: Parse error")
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+		}
+
+		params, err := wsv.fetchParams()
+		if err != nil {
+			log.Printf("Error: %v", err)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
 
 		w.Header().Add(def.CONTENT_TYPE, def.APP_JSON)
 
-		transaction := wallet.NewTransaction(priKey, pubKey, *t.SenderAddress, *t.RecipientAddress, value32)
-		signature := transaction.GenSignature()
-		signStr := signature.String()
-
-		//ノードへのrequest
-		req := &block.TransactionRequest{
-			SenderPublicKey:  t.SenderPublicKey,
-			SenderAddress:    t.SenderAddress,
-			RecipientAddress: t.RecipientAddress,
-			Value:            &value32,
-			Signature:        &signStr,
+		var m []byte
+		if params.IsUTXO() {
+			//未使用出力から支払いに使うものを選び、おつりを自分に戻す
+			utxos, err := wsv.fetchUTXOs(*t.SenderAddress)
+			if err != nil {
+				log.Printf("Error: %v", err)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+			payment, err := wallet.NewPayment(priKey, pubKey, *t.SenderAddress, *t.RecipientAddress, value, fee, utxos)
+			if err != nil {
+				log.Printf("Error: %v", err)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+			m, _ = json.Marshal(struct {
+				Inputs  []*wallet.TxInput  `json:"inputs"`
+				Outputs []*wallet.TxOutput `json:"outputs"`
+				Fee     utils.Amount       `json:"fee"`
+			}{
+				Inputs:  payment.SignInputs(),
+				Outputs: payment.Outputs(),
+				Fee:     payment.Fee(),
+			})
+		} else {
+			nonce, err := wsv.fetchNonce(*t.SenderAddress)
+			if err != nil {
+				log.Printf("Error: %v", err)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+			transaction := wallet.NewTransaction(priKey, pubKey, *t.SenderAddress, *t.RecipientAddress, value, fee, nonce)
+			signature := transaction.GenSignature()
+			signStr := signature.String()
+
+			//ノードへのrequest
+			req := &block.TransactionRequest{
+				SenderPublicKey:  t.SenderPublicKey,
+				SenderAddress:    t.SenderAddress,
+				RecipientAddress: t.RecipientAddress,
+				Value:            &value,
+				Fee:              &fee,
+				Nonce:            &nonce,
+				Signature:        &signStr,
+			}
+			m, _ = json.Marshal(req)
 		}
-		m, _ := json.Marshal(req)
 		buff := bytes.NewBuffer(m)
 		res, _ := http.Post(wsv.Gateway()+"/transactions", def.APP_JSON, buff)
 		if res.StatusCode == 201 {
@@ -122,6 +172,63 @@ func (wsv *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Requ
 	}
 }
 
+//ノードからaddressの次のnonceを取得
+func (wsv *WalletServer) fetchNonce(address string) (uint64, error) {
+	endpoint := fmt.Sprintf("%s/nonce?address=%s", wsv.Gateway(), url.QueryEscape(address))
+	res, err := http.Get(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return 0, fmt.Errorf("nonce request failed: %s", res.Status)
+	}
+	var v struct {
+		Nonce uint64 `json:"nonce"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return 0, err
+	}
+	return v.Nonce, nil
+}
+
+//ノードからネットワークのパラメータを取得
+func (wsv *WalletServer) fetchParams() (*block.Params, error) {
+	res, err := http.Get(wsv.Gateway() + "/params")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("params request failed: %s", res.Status)
+	}
+	params := new(block.Params)
+	if err := json.NewDecoder(res.Body).Decode(params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+//ノードからaddressの未使用出力を取得
+func (wsv *WalletServer) fetchUTXOs(address string) ([]*wallet.UTXO, error) {
+	endpoint := fmt.Sprintf("%s/utxos?address=%s", wsv.Gateway(), url.QueryEscape(address))
+	res, err := http.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("utxos request failed: %s", res.Status)
+	}
+	var v struct {
+		UTXOs []*wallet.UTXO `json:"utxos"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v.UTXOs, nil
+}
+
 func (wsv *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
@@ -154,8 +261,8 @@ func (wsv *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request)
 			}
 
 			m, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
+				Message string       `json:"message"`
+				Amount  utils.Amount `json:"amount"`
 			}{
 				Message: "success",
 				Amount:  amountRes.Amount,